@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/ybizeul/ybfeed/pkg/client"
+)
+
+// ClientConfig is the configuration file of the client command, flags and
+// environment variables take precedence over its values
+type ClientConfig struct {
+	Server string `json:"server"`
+	Feed   string `json:"feed"`
+	Secret string `json:"secret"`
+}
+
+// defaultClientConfigPath returns the path of the client configuration in
+// the user configuration directory
+func defaultClientConfigPath() string {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return path.Join(d, "ybfeed", "client.json")
+}
+
+// clientFlags are the flags of commands connecting to a remote feed
+var clientFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "server",
+		Aliases: []string{"s"},
+		EnvVars: []string{"YBF_SERVER"},
+		Usage:   "URL of the ybFeed server, like https://ybfeed.example.com",
+	},
+	&cli.StringFlag{
+		Name:    "feed",
+		Aliases: []string{"f"},
+		EnvVars: []string{"YBF_FEED"},
+		Usage:   "Feed name",
+	},
+	&cli.StringFlag{
+		Name:    "secret",
+		EnvVars: []string{"YBF_SECRET"},
+		Usage:   "Feed secret or token",
+	},
+	&cli.StringFlag{
+		Name:    "config",
+		Aliases: []string{"c"},
+		Value:   defaultClientConfigPath(),
+		EnvVars: []string{"YBF_CLIENT_CONFIG"},
+		Usage:   "Configuration file with server, feed and secret",
+	},
+}
+
+var clientCommand = &cli.Command{
+	Name:  "client",
+	Usage: "Read and write feeds on a remote server",
+	Flags: clientFlags,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "push",
+			Usage:     "Add a file, or standard input, to the feed",
+			ArgsUsage: "[file]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "type",
+					Usage: "Content type, detected from content by default",
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				c, feedName, err := newFeedClient(cCtx)
+				if err != nil {
+					return err
+				}
+
+				var r io.Reader = os.Stdin
+				fileName := ""
+				if cCtx.NArg() > 0 {
+					f, err := os.Open(cCtx.Args().First())
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					r = f
+					fileName = filepath.Base(f.Name())
+				}
+
+				contentType := cCtx.String("type")
+				if contentType == "" {
+					br := bufio.NewReader(r)
+					head, _ := br.Peek(512)
+					contentType = detectContentType(head, fileName)
+					r = br
+				}
+
+				// The server needs a file name to store unknown content
+				if fileName == "" && contentType == "application/octet-stream" {
+					fileName = "Pasted Data.bin"
+				}
+
+				return c.AddItem(cCtx.Context, feedName, contentType, fileName, r)
+			},
+		},
+		{
+			Name:      "pull",
+			Usage:     "Write an item, or the latest one, to standard output or a file",
+			ArgsUsage: "[item]",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "Write to file instead of standard output",
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				c, feedName, err := newFeedClient(cCtx)
+				if err != nil {
+					return err
+				}
+
+				itemName := cCtx.Args().First()
+				if itemName == "" {
+					f, err := c.GetFeed(cCtx.Context, feedName)
+					if err != nil {
+						return err
+					}
+					if len(f.Items) == 0 {
+						return fmt.Errorf("feed %s is empty", feedName)
+					}
+					itemName = f.Items[0].Name
+				}
+
+				content, err := c.GetItem(cCtx.Context, feedName, itemName)
+				if err != nil {
+					return err
+				}
+				defer content.Close()
+
+				var w io.Writer = os.Stdout
+				if o := cCtx.String("output"); o != "" {
+					f, err := os.Create(o)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					w = f
+				}
+
+				_, err = io.Copy(w, content)
+				return err
+			},
+		},
+		{
+			Name:  "ls",
+			Usage: "List items in the feed, most recent first",
+			Action: func(cCtx *cli.Context) error {
+				c, feedName, err := newFeedClient(cCtx)
+				if err != nil {
+					return err
+				}
+
+				f, err := c.GetFeed(cCtx.Context, feedName)
+				if err != nil {
+					return err
+				}
+				for _, i := range f.Items {
+					fmt.Printf("%s\t%s\n", i.Date.Format(time.RFC3339), i.Name)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "rm",
+			Usage:     "Remove an item from the feed",
+			ArgsUsage: "<item>",
+			Action: func(cCtx *cli.Context) error {
+				c, feedName, err := newFeedClient(cCtx)
+				if err != nil {
+					return err
+				}
+
+				if cCtx.NArg() != 1 {
+					return errors.New("expecting exactly one item name")
+				}
+
+				return c.DeleteItem(cCtx.Context, feedName, cCtx.Args().First())
+			},
+		},
+	},
+}
+
+// newFeedClient returns a client and the feed name configured with flags,
+// environment variables or configuration file
+func newFeedClient(cCtx *cli.Context) (*client.Client, string, error) {
+	config := ClientConfig{}
+
+	if p := cCtx.String("config"); p != "" {
+		b, err := os.ReadFile(p)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, "", err
+		}
+		if err == nil {
+			if err = json.Unmarshal(b, &config); err != nil {
+				return nil, "", fmt.Errorf("invalid configuration file %s: %w", p, err)
+			}
+		}
+	}
+
+	if s := cCtx.String("server"); s != "" {
+		config.Server = s
+	}
+	if f := cCtx.String("feed"); f != "" {
+		config.Feed = f
+	}
+	if s := cCtx.String("secret"); s != "" {
+		config.Secret = s
+	}
+
+	if config.Server == "" {
+		return nil, "", errors.New("server is not configured")
+	}
+	if config.Feed == "" {
+		return nil, "", errors.New("feed is not configured")
+	}
+
+	return client.New(config.Server, config.Secret), config.Feed, nil
+}
+
+// detectContentType returns the content type of an item starting with head.
+// Images and text from standard input are named by the server, other
+// content keeps its file name.
+func detectContentType(head []byte, fileName string) string {
+	contentType := http.DetectContentType(head)
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "application/octet-stream"
+	}
+
+	switch mediaType {
+	case "image/png", "image/jpeg":
+		return mediaType
+	case "text/plain":
+		if fileName == "" {
+			return mediaType
+		}
+	}
+
+	return "application/octet-stream"
+}
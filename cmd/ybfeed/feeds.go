@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/ybizeul/ybfeed/internal/feed"
+)
+
+var feedsCommand = &cli.Command{
+	Name:  "feeds",
+	Usage: "Manage feeds in data directory",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List feeds with usage statistics",
+			Action: func(cCtx *cli.Context) error {
+				stats, err := feedManager().Stats()
+				if err != nil {
+					return err
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "NAME\tITEMS\tBYTES\tLAST ACTIVITY")
+				for _, s := range stats {
+					fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", s.Name, s.Items, s.Bytes, s.LastActivity.Format(time.RFC3339))
+				}
+				return w.Flush()
+			},
+		},
+		{
+			Name:      "create",
+			Usage:     "Create a feed and print its secret",
+			ArgsUsage: "<name>",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "description",
+					Usage: "Description of the feed",
+				},
+				&cli.DurationFlag{
+					Name:  "retention",
+					Usage: "Delete items older than retention, like 72h",
+				},
+				&cli.StringFlag{
+					Name:  "owner",
+					Usage: "User owning the feed",
+				},
+			},
+			Action: func(cCtx *cli.Context) error {
+				name, err := feedArgs(cCtx, 1)
+				if err != nil {
+					return err
+				}
+				f, err := feedManager().CreateFeed(name[0], feed.FeedOptions{
+					Description: cCtx.String("description"),
+					Retention:   feed.Duration(cCtx.Duration("retention")),
+					Owner:       cCtx.String("owner"),
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Feed %s: %s\n", f.Name(), f.Config.Secret)
+				return nil
+			},
+		},
+		{
+			Name:      "delete",
+			Usage:     "Delete a feed and all its items",
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name, err := feedArgs(cCtx, 1)
+				if err != nil {
+					return err
+				}
+				if err = feedManager().DeleteFeed(name[0]); err != nil {
+					return err
+				}
+				fmt.Printf("Feed %s deleted\n", name[0])
+				return nil
+			},
+		},
+		{
+			Name:      "secret",
+			Usage:     "Print the secret of a feed, or of every feed without argument",
+			ArgsUsage: "[name]",
+			Action: func(cCtx *cli.Context) error {
+				fm := feedManager()
+				if cCtx.NArg() == 0 {
+					secrets, err := fm.Secrets()
+					if err != nil {
+						return err
+					}
+					for _, s := range secrets {
+						fmt.Printf("Feed %s: %s\n", s.Name, s.Secret)
+					}
+					return nil
+				}
+				name, err := feedArgs(cCtx, 1)
+				if err != nil {
+					return err
+				}
+				f, err := fm.GetFeed(name[0])
+				if err != nil {
+					return err
+				}
+				fmt.Println(f.Config.Secret)
+				return nil
+			},
+		},
+		{
+			Name:      "set-pin",
+			Usage:     "Set a temporary PIN to access a feed",
+			ArgsUsage: "<name> <pin>",
+			Action: func(cCtx *cli.Context) error {
+				args, err := feedArgs(cCtx, 2)
+				if err != nil {
+					return err
+				}
+				f, err := feedManager().GetFeed(args[0])
+				if err != nil {
+					return err
+				}
+				if err = f.SetPIN(args[1]); err != nil {
+					return err
+				}
+				fmt.Printf("PIN set for feed %s until %s\n", f.Name(), f.Config.PIN.Expiration.Format(time.RFC3339))
+				return nil
+			},
+		},
+		{
+			Name:      "rotate-secret",
+			Usage:     "Replace the secret of a feed, open connections of replicas sharing --redis-url are closed",
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name, err := feedArgs(cCtx, 1)
+				if err != nil {
+					return err
+				}
+				fm, closeBus, err := feedManagerWithBus()
+				if err != nil {
+					return err
+				}
+				defer closeBus()
+				f, err := fm.GetFeed(name[0])
+				if err != nil {
+					return err
+				}
+				if err = f.RotateSecret(); err != nil {
+					return err
+				}
+				fmt.Printf("Feed %s: %s\n", f.Name(), f.Config.Secret)
+				if redisURL == "" {
+					fmt.Fprintln(os.Stderr, "Connections opened with the previous secret stay open until the server is restarted, use --redis-url to close them")
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func feedManager() *feed.FeedManager {
+	return feed.NewFeedManager(dataDir, nil)
+}
+
+// feedManagerWithBus returns a FeedManager publishing notifications on the
+// Redis server of --redis-url, so that running replicas notify their
+// clients, and a function closing the bus. Notifications are dropped when
+// Redis isn't configured.
+func feedManagerWithBus() (*feed.FeedManager, func(), error) {
+	if redisURL == "" {
+		return feedManager(), func() {}, nil
+	}
+
+	bus, err := feed.NewRedisBus(redisURL, feed.DefaultBusChannel)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := feed.NewWebSocketManager(nil)
+	if err = m.UseBus(bus); err != nil {
+		bus.Close()
+		return nil, nil, err
+	}
+	fm := feed.NewFeedManager(dataDir, m)
+	m.FeedManager = fm
+
+	return fm, func() { bus.Close() }, nil
+}
+
+// feedArgs returns the arguments of the command, or an error if there
+// aren't exactly n of them
+func feedArgs(cCtx *cli.Context, n int) ([]string, error) {
+	if cCtx.NArg() != n {
+		return nil, fmt.Errorf("expecting %d arguments, got %d", n, cCtx.NArg())
+	}
+	return cCtx.Args().Slice(), nil
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"os"
+	"time"
 
 	"github.com/urfave/cli/v2"
+	"github.com/ybizeul/ybfeed/internal/feed"
 	"github.com/ybizeul/ybfeed/internal/handlers"
 	"golang.org/x/exp/slog"
 )
@@ -13,6 +16,21 @@ var LISTEN_ADDR string
 var DEBUG bool
 var dataDir string
 var maxBodySize int
+var adminToken string
+var cookieSecure string
+var cookieSameSite string
+var cookieMaxAge time.Duration
+var sessionMaxAge time.Duration
+var allowedOrigins cli.StringSlice
+var trustedProxies cli.StringSlice
+var oidcSettings handlers.OIDCSettings
+var anonymousFeeds bool
+var implicitFeeds bool
+var wsPingInterval time.Duration
+var wsPongWait time.Duration
+var wsWriteTimeout time.Duration
+var wsMaxSubscriptions int
+var redisURL string
 
 var logLevel slog.LevelVar
 
@@ -62,6 +80,129 @@ func main() {
 				Usage:       "Max upload size in MB",
 				Destination: &maxBodySize,
 			},
+			&cli.StringFlag{
+				Name:        "admin-token",
+				EnvVars:     []string{"YBF_ADMIN_TOKEN"},
+				Usage:       "Token required to access the admin API",
+				Destination: &adminToken,
+			},
+			&cli.StringFlag{
+				Name:        "cookie-secure",
+				Value:       handlers.CookieSecureAuto,
+				EnvVars:     []string{"YBF_COOKIE_SECURE"},
+				Usage:       "Secure attribute of cookies, auto sets it for TLS requests (auto, always, never)",
+				Destination: &cookieSecure,
+			},
+			&cli.StringFlag{
+				Name:        "cookie-samesite",
+				Value:       "lax",
+				EnvVars:     []string{"YBF_COOKIE_SAMESITE"},
+				Usage:       "SameSite attribute of cookies (lax, strict, none)",
+				Destination: &cookieSameSite,
+			},
+			&cli.DurationFlag{
+				Name:        "cookie-max-age",
+				Value:       handlers.DefaultCookieSettings().MaxAge,
+				EnvVars:     []string{"YBF_COOKIE_MAX_AGE"},
+				Usage:       "Lifetime of cookies",
+				Destination: &cookieMaxAge,
+			},
+			&cli.DurationFlag{
+				Name:        "session-max-age",
+				Value:       handlers.DefaultCookieSettings().SessionMaxAge,
+				EnvVars:     []string{"YBF_SESSION_MAX_AGE"},
+				Usage:       "Lifetime of user sessions",
+				Destination: &sessionMaxAge,
+			},
+			&cli.StringSliceFlag{
+				Name:        "allowed-origins",
+				EnvVars:     []string{"YBF_ALLOWED_ORIGINS"},
+				Usage:       "Additional origins allowed to send requests, like https://example.com",
+				Destination: &allowedOrigins,
+			},
+			&cli.StringSliceFlag{
+				Name:        "trusted-proxies",
+				EnvVars:     []string{"YBF_TRUSTED_PROXIES"},
+				Usage:       "Addresses or networks of reverse proxies allowed to set X-Forwarded-Host, like 10.0.0.0/8",
+				Destination: &trustedProxies,
+			},
+			&cli.StringFlag{
+				Name:        "oidc-issuer",
+				EnvVars:     []string{"YBF_OIDC_ISSUER"},
+				Usage:       "OpenID Connect issuer URL, enables login with OpenID Connect",
+				Destination: &oidcSettings.Issuer,
+			},
+			&cli.StringFlag{
+				Name:        "oidc-client-id",
+				EnvVars:     []string{"YBF_OIDC_CLIENT_ID"},
+				Usage:       "OpenID Connect client ID",
+				Destination: &oidcSettings.ClientID,
+			},
+			&cli.StringFlag{
+				Name:        "oidc-client-secret",
+				EnvVars:     []string{"YBF_OIDC_CLIENT_SECRET"},
+				Usage:       "OpenID Connect client secret",
+				Destination: &oidcSettings.ClientSecret,
+			},
+			&cli.StringFlag{
+				Name:        "oidc-redirect-url",
+				EnvVars:     []string{"YBF_OIDC_REDIRECT_URL"},
+				Usage:       "OpenID Connect redirect URL, like https://ybfeed.example.com/auth/callback",
+				Destination: &oidcSettings.RedirectURL,
+			},
+			&cli.BoolFlag{
+				Name:        "anonymous-feeds",
+				EnvVars:     []string{"YBF_ANONYMOUS_FEEDS"},
+				Usage:       "Allow anonymous users to create feeds",
+				Destination: &anonymousFeeds,
+			},
+			&cli.BoolFlag{
+				Name:        "implicit-feeds",
+				Value:       true,
+				EnvVars:     []string{"YBF_IMPLICIT_FEEDS"},
+				Usage:       "Create unknown feeds when they are opened, use --implicit-feeds=false to only create feeds with POST /api/feeds",
+				Destination: &implicitFeeds,
+			},
+			&cli.DurationFlag{
+				Name:        "ws-ping-interval",
+				Value:       feed.DefaultPingInterval,
+				EnvVars:     []string{"YBF_WS_PING_INTERVAL"},
+				Usage:       "Delay between pings sent to websocket clients",
+				Destination: &wsPingInterval,
+			},
+			&cli.DurationFlag{
+				Name:        "ws-pong-wait",
+				Value:       feed.DefaultPongWait,
+				EnvVars:     []string{"YBF_WS_PONG_WAIT"},
+				Usage:       "Time after which a websocket client that didn't answer pings is disconnected",
+				Destination: &wsPongWait,
+			},
+			&cli.DurationFlag{
+				Name:        "ws-write-timeout",
+				Value:       feed.DefaultWriteTimeout,
+				EnvVars:     []string{"YBF_WS_WRITE_TIMEOUT"},
+				Usage:       "Time allowed to write a message to a websocket client",
+				Destination: &wsWriteTimeout,
+			},
+			&cli.IntFlag{
+				Name:        "ws-max-subscriptions",
+				Value:       feed.DefaultMaxSubscriptions,
+				EnvVars:     []string{"YBF_WS_MAX_SUBSCRIPTIONS"},
+				Usage:       "Number of feeds a websocket connected to /ws can subscribe to",
+				Destination: &wsMaxSubscriptions,
+			},
+			&cli.StringFlag{
+				Name:        "redis-url",
+				EnvVars:     []string{"YBF_REDIS_URL"},
+				Usage:       "Redis server used to share notifications between replicas, like redis://localhost:6379/0",
+				Destination: &redisURL,
+			},
+		},
+		Commands: []*cli.Command{
+			feedsCommand,
+			usersCommand,
+			clientCommand,
+			syncCommand,
 		},
 		Action: func(cCtx *cli.Context) error {
 			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: &logLevel}))
@@ -93,6 +234,61 @@ func run() {
 	api.MaxBodySize = maxBodySize * 1024 * 1024
 	api.HttpPort = HTTP_PORT
 	api.ListenAddr = LISTEN_ADDR
+	if adminToken != "" {
+		api.Config.AdminToken = adminToken
+	}
+
+	api.Cookie.Secure, err = handlers.ParseCookieSecure(cookieSecure)
+	if err != nil {
+		slog.Error("Invalid cookie configuration", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	api.Cookie.SameSite, err = handlers.ParseSameSite(cookieSameSite)
+	if err != nil {
+		slog.Error("Invalid cookie configuration", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	api.Cookie.MaxAge = cookieMaxAge
+	api.Cookie.SessionMaxAge = sessionMaxAge
+	api.AllowedOrigins = allowedOrigins.Value()
+	api.TrustedProxies, err = handlers.ParseTrustedProxies(trustedProxies.Value())
+	if err != nil {
+		slog.Error("Invalid trusted proxies", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+	api.AnonymousFeeds = anonymousFeeds
+	api.ImplicitFeeds = implicitFeeds
+
+	if wsPongWait <= wsPingInterval {
+		slog.Error("Invalid websocket configuration, pong wait must be longer than ping interval",
+			slog.Duration("ping_interval", wsPingInterval),
+			slog.Duration("pong_wait", wsPongWait))
+		os.Exit(1)
+	}
+	api.WebSocketManager.PingInterval = wsPingInterval
+	api.WebSocketManager.PongWait = wsPongWait
+	api.WebSocketManager.WriteTimeout = wsWriteTimeout
+	api.WebSocketManager.MaxItemSize = int64(api.MaxBodySize)
+	api.WebSocketManager.MaxSubscriptions = wsMaxSubscriptions
+
+	if redisURL != "" {
+		bus, err := feed.NewRedisBus(redisURL, feed.DefaultBusChannel)
+		if err != nil {
+			slog.Error("Unable to connect to Redis", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+		if err = api.WebSocketManager.UseBus(bus); err != nil {
+			slog.Error("Unable to subscribe to Redis", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	if oidcSettings.Issuer != "" {
+		if err = api.EnableOIDC(context.Background(), oidcSettings); err != nil {
+			slog.Error("Unable to enable OpenID Connect", slog.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
 
 	api.StartServer()
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"github.com/ybizeul/ybfeed/internal/clipsync"
+)
+
+var syncCommand = &cli.Command{
+	Name:  "sync",
+	Usage: "Synchronize the clipboard with a feed on a remote server",
+	Description: "Text and images copied to the clipboard are posted to the feed, and text and\n" +
+		"images added to the feed are copied to the clipboard.",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "clipboard",
+			Value:   "auto",
+			EnvVars: []string{"YBF_CLIPBOARD"},
+			Usage:   "Clipboard backend, one of auto, xclip, wayland or macos",
+		},
+		&cli.DurationFlag{
+			Name:  "interval",
+			Value: clipsync.DefaultInterval,
+			Usage: "Delay between clipboard checks",
+		},
+	}, clientFlags...),
+	Action: func(cCtx *cli.Context) error {
+		c, feedName, err := newFeedClient(cCtx)
+		if err != nil {
+			return err
+		}
+
+		cb, err := clipsync.NewClipboard(cCtx.String("clipboard"))
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cCtx.Context, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		s := clipsync.NewSyncer(c, feedName, cb)
+		s.Interval = cCtx.Duration("interval")
+
+		return s.Run(ctx)
+	},
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/ybizeul/ybfeed/internal/users"
+	"golang.org/x/term"
+)
+
+var usersCommand = &cli.Command{
+	Name:  "users",
+	Usage: "Manage local user accounts",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Usage:     "Create a user, password is read from standard input",
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name, err := userArg(cCtx)
+				if err != nil {
+					return err
+				}
+				password, err := readPassword()
+				if err != nil {
+					return err
+				}
+				if _, err = userManager().Create(name, password); err != nil {
+					return err
+				}
+				fmt.Printf("User %s created\n", name)
+				return nil
+			},
+		},
+		{
+			Name:  "list",
+			Usage: "List users",
+			Action: func(cCtx *cli.Context) error {
+				names, err := userManager().List()
+				if err != nil {
+					return err
+				}
+				for _, n := range names {
+					fmt.Println(n)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "passwd",
+			Usage:     "Change the password of a user, password is read from standard input",
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name, err := userArg(cCtx)
+				if err != nil {
+					return err
+				}
+				password, err := readPassword()
+				if err != nil {
+					return err
+				}
+				if err = userManager().SetPassword(name, password); err != nil {
+					return err
+				}
+				fmt.Printf("Password changed for %s\n", name)
+				return nil
+			},
+		},
+		{
+			Name:      "delete",
+			Usage:     "Delete a user",
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name, err := userArg(cCtx)
+				if err != nil {
+					return err
+				}
+				if err = userManager().Delete(name); err != nil {
+					return err
+				}
+				if err = feedManager().RemoveUser(name); err != nil {
+					return err
+				}
+				fmt.Printf("User %s deleted\n", name)
+				return nil
+			},
+		},
+		{
+			Name:      "revoke",
+			Usage:     "End all sessions of a local or OpenID Connect user",
+			ArgsUsage: "<name>",
+			Action: func(cCtx *cli.Context) error {
+				name, err := userArg(cCtx)
+				if err != nil {
+					return err
+				}
+				err = userManager().RevokeSessions(name)
+				if errors.Is(err, users.UserErrorNotFound) {
+					err = users.NewSessionManager(path.Join(dataDir, "sessions.json")).Revoke(name)
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Sessions of %s revoked\n", name)
+				return nil
+			},
+		},
+	},
+}
+
+func userManager() *users.UserManager {
+	return users.NewUserManager(path.Join(dataDir, "users.json"))
+}
+
+func userArg(cCtx *cli.Context) (string, error) {
+	if cCtx.NArg() != 1 {
+		return "", errors.New("expecting exactly one user name")
+	}
+	return cCtx.Args().First(), nil
+}
+
+// readPassword prompts for a password on a terminal, or reads the first line
+// of standard input otherwise
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("unable to read password")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,130 @@
+package clipsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// Content types exchanged with the clipboard
+const (
+	TypeText = "text/plain"
+	TypePNG  = "image/png"
+)
+
+// ClipboardErrorUnknownBackend is returned when the clipboard backend name
+// isn't supported
+var ClipboardErrorUnknownBackend = errors.New("unknown clipboard backend")
+
+// Content is the content of the clipboard
+type Content struct {
+	Type string
+	Data []byte
+}
+
+// hash identifies content to detect changes
+func (c Content) hash() [sha256.Size]byte {
+	return sha256.Sum256(append([]byte(c.Type+"\x00"), c.Data...))
+}
+
+// Clipboard is a system clipboard holding text or images. Read returns
+// empty content when the clipboard is empty.
+type Clipboard interface {
+	Read(ctx context.Context) (Content, error)
+	Write(ctx context.Context, content Content) error
+}
+
+// CommandClipboard is a Clipboard accessed through external commands. Read
+// commands write the content on standard output, write commands read it
+// from standard input. The image content type is appended to WriteImage.
+// Images are not supported when image commands are empty.
+type CommandClipboard struct {
+	ReadText   []string
+	WriteText  []string
+	ReadImage  []string
+	WriteImage []string
+}
+
+// Clipboard backends
+var (
+	XClipClipboard = &CommandClipboard{
+		ReadText:   []string{"xclip", "-selection", "clipboard", "-o"},
+		WriteText:  []string{"xclip", "-selection", "clipboard", "-i"},
+		ReadImage:  []string{"xclip", "-selection", "clipboard", "-o", "-t", TypePNG},
+		WriteImage: []string{"xclip", "-selection", "clipboard", "-i", "-t"},
+	}
+	WaylandClipboard = &CommandClipboard{
+		ReadText:   []string{"wl-paste", "--no-newline"},
+		WriteText:  []string{"wl-copy"},
+		ReadImage:  []string{"wl-paste", "--type", TypePNG},
+		WriteImage: []string{"wl-copy", "--type"},
+	}
+	MacOSClipboard = &CommandClipboard{
+		ReadText:  []string{"pbpaste"},
+		WriteText: []string{"pbcopy"},
+	}
+)
+
+// NewClipboard returns the clipboard backend named name, one of xclip,
+// wayland or macos. With auto, the backend is detected from the
+// environment.
+func NewClipboard(name string) (Clipboard, error) {
+	switch name {
+	case "auto", "":
+		switch {
+		case runtime.GOOS == "darwin":
+			return MacOSClipboard, nil
+		case os.Getenv("WAYLAND_DISPLAY") != "":
+			return WaylandClipboard, nil
+		default:
+			return XClipClipboard, nil
+		}
+	case "xclip":
+		return XClipClipboard, nil
+	case "wayland":
+		return WaylandClipboard, nil
+	case "macos":
+		return MacOSClipboard, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ClipboardErrorUnknownBackend, name)
+}
+
+// Read returns the image in the clipboard if there is one, or its text
+func (c *CommandClipboard) Read(ctx context.Context) (Content, error) {
+	if len(c.ReadImage) > 0 {
+		// Image commands fail when the clipboard doesn't hold an image
+		if b, err := exec.CommandContext(ctx, c.ReadImage[0], c.ReadImage[1:]...).Output(); err == nil && len(b) > 0 {
+			return Content{Type: TypePNG, Data: b}, nil
+		}
+	}
+
+	b, err := exec.CommandContext(ctx, c.ReadText[0], c.ReadText[1:]...).Output()
+	if err != nil {
+		// Reading an empty clipboard fails with some backends
+		return Content{}, nil
+	}
+	return Content{Type: TypeText, Data: b}, nil
+}
+
+// Write replaces the clipboard content
+func (c *CommandClipboard) Write(ctx context.Context, content Content) error {
+	var args []string
+	switch content.Type {
+	case TypeText:
+		args = c.WriteText
+	default:
+		if len(c.WriteImage) == 0 {
+			return fmt.Errorf("clipboard doesn't support %s", content.Type)
+		}
+		args = append(append([]string{}, c.WriteImage...), content.Type)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(content.Data)
+	return cmd.Run()
+}
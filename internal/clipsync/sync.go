@@ -0,0 +1,183 @@
+// Package clipsync synchronizes the local clipboard with a feed: new
+// clipboard content is posted to the feed and items added to the feed are
+// copied to the clipboard.
+package clipsync
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ybizeul/ybfeed/pkg/client"
+	"github.com/ybizeul/ybfeed/pkg/yblog"
+	"golang.org/x/exp/slog"
+)
+
+var sL = yblog.NewYBLogger("sync", []string{"DEBUG", "DEBUG_SYNC"})
+
+// Default settings of a Syncer
+const (
+	DefaultInterval   = 500 * time.Millisecond
+	DefaultRetryDelay = 5 * time.Second
+)
+
+// maxContentSize is the largest item copied to the clipboard
+const maxContentSize = 32 * 1024 * 1024
+
+// Syncer synchronizes Clipboard with feed Feed. The clipboard is checked
+// for changes every Interval, and the websocket is reconnected after
+// RetryDelay when the connection is lost.
+//
+// Loops are prevented by remembering the last content seen, either read from
+// the clipboard or received from the feed. Content identical to it is
+// neither posted nor copied again.
+type Syncer struct {
+	Client     *client.Client
+	Feed       string
+	Clipboard  Clipboard
+	Interval   time.Duration
+	RetryDelay time.Duration
+
+	last [sha256.Size]byte
+}
+
+// NewSyncer returns a Syncer between clipboard cb and feed feedName on the
+// server of c
+func NewSyncer(c *client.Client, feedName string, cb Clipboard) *Syncer {
+	return &Syncer{
+		Client:     c,
+		Feed:       feedName,
+		Clipboard:  cb,
+		Interval:   DefaultInterval,
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// Run synchronizes the clipboard until ctx is done, or the feed can't be
+// accessed. Content already in the clipboard when starting isn't posted.
+func (s *Syncer) Run(ctx context.Context) error {
+	if content, err := s.Clipboard.Read(ctx); err == nil {
+		s.last = content.hash()
+	}
+
+	for {
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, client.ErrorUnauthorized) ||
+			errors.Is(err, client.ErrorForbidden) ||
+			errors.Is(err, client.ErrorNotFound) {
+			return err
+		}
+
+		sL.Logger.Warn("Connection to feed lost", slog.String("feed", s.Feed), slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.RetryDelay):
+		}
+	}
+}
+
+// run subscribes to the feed and synchronizes until the subscription ends
+func (s *Syncer) run(ctx context.Context) error {
+	sub, err := s.Client.Subscribe(ctx, s.Feed)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	sL.Logger.Info("Synchronizing clipboard", slog.String("feed", s.Feed))
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n, ok := <-sub.Notifications():
+			if !ok {
+				return sub.Err()
+			}
+			switch n.Action {
+			case client.ActionRenamed:
+				s.Feed = n.Name
+			case client.ActionAdd:
+				if err = s.pull(ctx, n.Item); err != nil {
+					sL.Logger.Error("Unable to copy item to clipboard", slog.String("item", n.Item.Name), slog.String("error", err.Error()))
+				}
+			}
+		case <-ticker.C:
+			if err = s.push(ctx); err != nil {
+				sL.Logger.Error("Unable to post clipboard", slog.String("feed", s.Feed), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// push posts the clipboard content to the feed if it changed
+func (s *Syncer) push(ctx context.Context) error {
+	content, err := s.Clipboard.Read(ctx)
+	if err != nil {
+		return err
+	}
+	if len(content.Data) == 0 {
+		return nil
+	}
+
+	h := content.hash()
+	if h == s.last {
+		return nil
+	}
+	// Failed posts are not retried on every tick
+	s.last = h
+
+	sL.Logger.Debug("Posting clipboard", slog.String("type", content.Type), slog.Int("size", len(content.Data)))
+
+	return s.Client.AddItem(ctx, s.Feed, content.Type, "", bytes.NewReader(content.Data))
+}
+
+// pull copies item to the clipboard if it is text or an image different
+// from the last content seen
+func (s *Syncer) pull(ctx context.Context, item client.Item) error {
+	if item.Type != client.Text && item.Type != client.Image {
+		return nil
+	}
+
+	r, err := s.Client.GetItem(ctx, s.Feed, item.Name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, maxContentSize+1))
+	if err != nil {
+		return err
+	}
+	if len(b) > maxContentSize {
+		sL.Logger.Warn("Item too large for clipboard", slog.String("item", item.Name))
+		return nil
+	}
+
+	content := Content{Type: TypeText, Data: b}
+	if item.Type == client.Image {
+		content.Type = http.DetectContentType(b)
+	}
+
+	h := content.hash()
+	if h == s.last {
+		return nil
+	}
+	s.last = h
+
+	sL.Logger.Debug("Copying item to clipboard", slog.String("item", item.Name), slog.String("type", content.Type))
+
+	return s.Clipboard.Write(ctx, content)
+}
@@ -0,0 +1,182 @@
+package clipsync
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ybizeul/ybfeed/internal/handlers"
+	"github.com/ybizeul/ybfeed/pkg/client"
+)
+
+// fakeClipboard is an in memory Clipboard
+type fakeClipboard struct {
+	mutex   sync.Mutex
+	content Content
+	reads   int
+	writes  int
+}
+
+func (c *fakeClipboard) Read(ctx context.Context) (Content, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.reads++
+	return c.content, nil
+}
+
+func (c *fakeClipboard) Write(ctx context.Context, content Content) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.content = content
+	c.writes++
+	return nil
+}
+
+// copy simulates a user copying text
+func (c *fakeClipboard) copy(text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.content = Content{Type: TypeText, Data: []byte(text)}
+}
+
+func (c *fakeClipboard) text() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return string(c.content.Data)
+}
+
+func newTestClient(t *testing.T) (*client.Client, string) {
+	api, err := handlers.NewApiHandler(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	api.MaxBodySize = 5 * 1024 * 1024
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	f, err := client.New(server.URL, "").GetFeed(context.Background(), "clipboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.New(server.URL, f.Secret), f.Name
+}
+
+// eventually fails the test if cond isn't true within a few seconds
+func eventually(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, feedName := newTestClient(t)
+
+	cb := &fakeClipboard{}
+	cb.copy("already there")
+
+	s := NewSyncer(c, feedName, cb)
+	s.Interval = 10 * time.Millisecond
+
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	// Wait for the syncer to poll the clipboard once connected
+	eventually(t, "Expect clipboard to be polled", func() bool {
+		cb.mutex.Lock()
+		defer cb.mutex.Unlock()
+		return cb.reads > 1
+	})
+
+	// Local copy is posted to the feed
+	cb.copy("from laptop")
+	eventually(t, "Expect clipboard to be posted", func() bool {
+		f, err := c.GetFeed(ctx, feedName)
+		if err != nil || len(f.Items) != 1 {
+			return false
+		}
+		r, err := c.GetItem(ctx, feedName, f.Items[0].Name)
+		if err != nil {
+			return false
+		}
+		defer r.Close()
+		b, _ := io.ReadAll(r)
+		return string(b) == "from laptop"
+	})
+
+	f, err := c.GetFeed(ctx, feedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Items) != 1 {
+		t.Errorf("Expect content present at start not to be posted, got %v", f.Items)
+	}
+
+	// Remote items are copied to the clipboard
+	if err = c.AddItem(ctx, feedName, "text/plain", "", strings.NewReader("from vdi")); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "Expect item to be copied to clipboard", func() bool {
+		return cb.text() == "from vdi"
+	})
+
+	// Neither the echo of our post nor the copied item are synchronized again
+	sub, err := c.Subscribe(ctx, feedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	select {
+	case n := <-sub.Notifications():
+		t.Errorf("Unexpected notification %+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+	cb.mutex.Lock()
+	writes := cb.writes
+	cb.mutex.Unlock()
+	if writes != 1 {
+		t.Errorf("Expect 1 clipboard write but got %d", writes)
+	}
+
+	// Binary items are ignored
+	if err = c.AddItem(ctx, feedName, "application/octet-stream", "archive.zip", strings.NewReader("PK")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if cb.text() != "from vdi" {
+		t.Errorf("Expect binary item to be ignored, got %s", cb.text())
+	}
+
+	cancel()
+	if err = <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncUnauthorized(t *testing.T) {
+	c, feedName := newTestClient(t)
+	c.Secret = "foo"
+
+	s := NewSyncer(c, feedName, &fakeClipboard{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.Run(ctx); err == nil {
+		t.Error("Expect error with wrong secret")
+	}
+}
@@ -0,0 +1,197 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// DefaultAliasLifetime is the time during which the previous name of a
+// renamed feed redirects to the new name
+const DefaultAliasLifetime = 7 * 24 * time.Hour
+
+// aliasesFile is the file in data directory storing feed aliases
+const aliasesFile = "aliases.json"
+
+// FeedErrorCantRename is returned when a feed directory can't be moved
+var FeedErrorCantRename = errors.New("can't rename feed")
+
+// Alias is a previous name of a feed
+type Alias struct {
+	Target  string    `json:"target"`
+	Expires time.Time `json:"expires"`
+}
+
+// readAliases returns aliases stored in data folder, without expired ones
+func (m *FeedManager) readAliases() (map[string]Alias, error) {
+	result := map[string]Alias{}
+
+	b, err := os.ReadFile(path.Join(m.path, aliasesFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for name, a := range result {
+		if a.Expires.Before(now) {
+			delete(result, name)
+		}
+	}
+
+	return result, nil
+}
+
+// writeAliases saves aliases to data folder
+func (m *FeedManager) writeAliases(aliases map[string]Alias) error {
+	b, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(m.path, aliasesFile), b, 0600)
+}
+
+// Alias returns the current name of the feed previously named feedName, if
+// feedName is an alias that hasn't expired and no feed is named feedName.
+func (m *FeedManager) Alias(feedName string) (string, bool) {
+	feedName, err := NormalizeFeedName(feedName)
+	if err != nil {
+		return "", false
+	}
+
+	if _, err = os.Stat(path.Join(m.path, feedName)); err == nil {
+		return "", false
+	}
+
+	m.aliasMutex.Lock()
+	defer m.aliasMutex.Unlock()
+
+	aliases, err := m.readAliases()
+	if err != nil {
+		fL.Logger.Error("Unable to read aliases", slog.String("error", err.Error()))
+		return "", false
+	}
+
+	a, ok := aliases[feedName]
+	if !ok {
+		return "", false
+	}
+	return a.Target, true
+}
+
+// removeAlias deletes alias feedName, if it exists
+func (m *FeedManager) removeAlias(feedName string) error {
+	m.aliasMutex.Lock()
+	defer m.aliasMutex.Unlock()
+
+	aliases, err := m.readAliases()
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[feedName]; !ok {
+		return nil
+	}
+	delete(aliases, feedName)
+	return m.writeAliases(aliases)
+}
+
+// removeAliasesTo deletes all aliases of feedName
+func (m *FeedManager) removeAliasesTo(feedName string) error {
+	m.aliasMutex.Lock()
+	defer m.aliasMutex.Unlock()
+
+	aliases, err := m.readAliases()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for name, a := range aliases {
+		if a.Target == feedName {
+			delete(aliases, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return m.writeAliases(aliases)
+}
+
+// RenameFeed moves feed oldName to newName. oldName stays as an alias of
+// newName during AliasLifetime and connected websockets are notified.
+func (m *FeedManager) RenameFeed(oldName string, newName string) (*Feed, error) {
+	f, err := m.GetFeed(oldName)
+	if err != nil {
+		return nil, err
+	}
+	oldName = f.Name()
+
+	newName, err = NormalizeFeedName(newName)
+	if err != nil {
+		return nil, err
+	}
+
+	newPath := path.Join(m.path, newName)
+
+	m.feedMutex.Lock()
+	defer m.feedMutex.Unlock()
+
+	m.aliasMutex.Lock()
+	defer m.aliasMutex.Unlock()
+
+	aliases, err := m.readAliases()
+	if err != nil {
+		return nil, err
+	}
+
+	// An existing directory, even empty, is never replaced
+	if err = renameNoReplace(f.Path, newPath); err != nil {
+		if errors.Is(err, os.ErrExist) || errors.Is(err, syscall.ENOTEMPTY) {
+			return nil, fmt.Errorf("%w: %s", FeedErrorAlreadyExists, newName)
+		}
+		return nil, fmt.Errorf("%w: %s", FeedErrorCantRename, err.Error())
+	}
+
+	// Previous aliases follow the feed to its new name
+	expires := time.Now().Add(m.AliasLifetime)
+	for name, a := range aliases {
+		if a.Target == oldName {
+			aliases[name] = Alias{Target: newName, Expires: a.Expires}
+		}
+	}
+	delete(aliases, newName)
+	aliases[oldName] = Alias{Target: newName, Expires: expires}
+
+	if err = m.writeAliases(aliases); err != nil {
+		fL.Logger.Error("Unable to write aliases", slog.String("error", err.Error()))
+	}
+
+	fL.Logger.Info("Renamed feed", slog.String("feed", oldName), slog.String("name", newName))
+
+	if m.websocketManager != nil {
+		m.websocketManager.RenameFeed(oldName, newName)
+	}
+
+	return m.GetFeed(newName)
+}
+
+// renameChecked moves oldPath to newPath if it doesn't exist. Callers hold
+// feedMutex so feeds aren't created or renamed in between.
+func renameChecked(oldPath string, newPath string) error {
+	if _, err := os.Lstat(newPath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+	return os.Rename(oldPath, newPath)
+}
@@ -0,0 +1,168 @@
+package feed
+
+import (
+	"sync"
+)
+
+// BusHandler receives notifications of feed feedName published on a Bus
+type BusHandler func(feedName string, n FeedNotification)
+
+// Bus carries feed notifications between the ybFeed replicas sharing a
+// data directory. Notifications published by any replica are delivered to
+// the handlers of all replicas, including the one publishing, in the same
+// order.
+//
+// The bus numbers notifications of each feed when they are published, so
+// that they have the same sequence on all replicas. The sequence of a feed
+// follows it when it is renamed, and restarts when it is closed.
+type Bus interface {
+	// Publish numbers notification n of feed feedName and sends it to all
+	// replicas
+	Publish(feedName string, n FeedNotification) error
+
+	// Subscribe registers handler to receive all notifications
+	Subscribe(handler BusHandler) error
+
+	// Join adds device d to the devices connected to feed feedName, and
+	// sends a join notification to all replicas. Presence notifications
+	// aren't numbered.
+	Join(feedName string, d Device) error
+
+	// Leave removes device d from the devices connected to feed feedName,
+	// and sends a leave notification to all replicas
+	Leave(feedName string, d Device) error
+
+	// Devices returns the devices connected to feed feedName on all
+	// replicas
+	Devices(feedName string) ([]Device, error)
+
+	// Close stops delivering notifications
+	Close() error
+}
+
+// LocalBus is a Bus delivering notifications to handlers of the current
+// process. Handlers are called synchronously by Publish. It is the default
+// bus of a WebSocketManager, for deployments with a single replica.
+type LocalBus struct {
+	// mutex serializes Publish, so that handlers receive notifications in
+	// the same order
+	mutex sync.Mutex
+	seqs  map[string]uint64
+
+	// dataMutex protects handlers and devices. Presence changes don't
+	// take mutex, as handlers change presence when they drop clients.
+	dataMutex sync.Mutex
+	handlers  []BusHandler
+	devices   map[string]map[string]Device
+}
+
+// NewLocalBus creates a new LocalBus
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+// Publish numbers notification n of feed feedName and calls all handlers
+// with it
+func (b *LocalBus) Publish(feedName string, n FeedNotification) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.seqs == nil {
+		b.seqs = map[string]uint64{}
+	}
+	b.seqs[feedName]++
+	n.Seq = b.seqs[feedName]
+
+	b.dataMutex.Lock()
+	switch n.Action {
+	case ActionRenamed:
+		b.seqs[n.Name] = n.Seq
+		delete(b.seqs, feedName)
+		if devices, ok := b.devices[feedName]; ok {
+			b.devices[n.Name] = devices
+			delete(b.devices, feedName)
+		}
+	case ActionClosed:
+		delete(b.seqs, feedName)
+		delete(b.devices, feedName)
+	}
+	handlers := b.handlers
+	b.dataMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(feedName, n)
+	}
+	return nil
+}
+
+// Join adds device d to feed feedName and calls all handlers with a join
+// notification
+func (b *LocalBus) Join(feedName string, d Device) error {
+	b.dataMutex.Lock()
+	if b.devices == nil {
+		b.devices = map[string]map[string]Device{}
+	}
+	if b.devices[feedName] == nil {
+		b.devices[feedName] = map[string]Device{}
+	}
+	b.devices[feedName][d.ID] = d
+	handlers := b.handlers
+	b.dataMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(feedName, FeedNotification{Action: ActionJoin, Device: &d})
+	}
+	return nil
+}
+
+// Leave removes device d from feed feedName and calls all handlers with a
+// leave notification if it was connected
+func (b *LocalBus) Leave(feedName string, d Device) error {
+	b.dataMutex.Lock()
+	if _, ok := b.devices[feedName][d.ID]; !ok {
+		b.dataMutex.Unlock()
+		return nil
+	}
+	delete(b.devices[feedName], d.ID)
+	if len(b.devices[feedName]) == 0 {
+		delete(b.devices, feedName)
+	}
+	handlers := b.handlers
+	b.dataMutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(feedName, FeedNotification{Action: ActionLeave, Device: &d})
+	}
+	return nil
+}
+
+// Devices returns the devices connected to feed feedName
+func (b *LocalBus) Devices(feedName string) ([]Device, error) {
+	b.dataMutex.Lock()
+	defer b.dataMutex.Unlock()
+
+	result := []Device{}
+	for _, d := range b.devices[feedName] {
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// Subscribe adds handler to the handlers receiving notifications
+func (b *LocalBus) Subscribe(handler BusHandler) error {
+	b.dataMutex.Lock()
+	defer b.dataMutex.Unlock()
+
+	// Handlers are copied by publishers, they are never modified in place
+	b.handlers = append(b.handlers[:len(b.handlers):len(b.handlers)], handler)
+	return nil
+}
+
+// Close removes all handlers
+func (b *LocalBus) Close() error {
+	b.dataMutex.Lock()
+	defer b.dataMutex.Unlock()
+
+	b.handlers = nil
+	return nil
+}
@@ -0,0 +1,261 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	ws "github.com/gorilla/websocket"
+)
+
+// newReplica returns a WebSocketManager and a FeedManager for dir, using
+// bus
+func newReplica(t *testing.T, dir string, bus Bus) (*WebSocketManager, *FeedManager) {
+	m := NewWebSocketManager(nil)
+	fm := NewFeedManager(dir, m)
+	m.FeedManager = fm
+	if err := m.UseBus(bus); err != nil {
+		t.Fatal(err)
+	}
+	return m, fm
+}
+
+// testBuses returns pairs of buses connecting two replicas
+var testBuses = map[string]func(t *testing.T) (Bus, Bus){
+	"local": func(t *testing.T) (Bus, Bus) {
+		b := NewLocalBus()
+		return b, b
+	},
+	"redis": func(t *testing.T) (Bus, Bus) {
+		s := miniredis.RunT(t)
+		buses := []Bus{}
+		for i := 0; i < 2; i++ {
+			b, err := NewRedisBus("redis://"+s.Addr(), DefaultBusChannel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { b.Close() })
+			buses = append(buses, b)
+		}
+		return buses[0], buses[1]
+	},
+}
+
+func TestBus(t *testing.T) {
+	for name, newBuses := range testBuses {
+		t.Run(name, func(t *testing.T) {
+			b1, b2 := newBuses(t)
+			dir := t.TempDir()
+			_, fm1 := newReplica(t, dir, b1)
+			m2, fm2 := newReplica(t, dir, b2)
+
+			f1, err := fm1.CreateFeed("replicated", FeedOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f2, err := fm2.GetFeed("replicated")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				m2.RunSocketForFeed(f2, f2.Config.Secret, authorizeSecret(fm2), w, r)
+			}))
+			defer server.Close()
+			c := dialWebSocket(t, server)
+			defer c.Close()
+			waitForCount(t, m2, f2.Name(), 1)
+
+			// Items added on a replica are notified on the others
+			if err = f1.AddItem("text/plain", "", strings.NewReader("hello")); err != nil {
+				t.Fatal(err)
+			}
+			_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			var n FeedNotification
+			if err = c.ReadJSON(&n); err != nil {
+				t.Fatal(err)
+			}
+			if n.Action != "add" || n.Item.Name != "Pasted Text.txt" || n.Seq != 1 {
+				t.Fatalf("Unexpected notification %+v", n)
+			}
+
+			// Feeds deleted on a replica are closed on the others
+			if err = fm1.DeleteFeed(f1.Name()); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = c.ReadMessage()
+			if !ws.IsCloseError(err, CloseFeedDeleted) {
+				t.Fatalf("Expect close code %d but got %v", CloseFeedDeleted, err)
+			}
+		})
+	}
+}
+
+// waitForSeq waits for m to receive notification seq of feed feedName
+func waitForSeq(t *testing.T, m *WebSocketManager, feedName string, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Seq(feedName) != seq {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expect sequence %d but got %d", seq, m.Seq(feedName))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBusSequences(t *testing.T) {
+	for name, newBuses := range testBuses {
+		t.Run(name, func(t *testing.T) {
+			b1, b2 := newBuses(t)
+			m1 := NewWebSocketManager(nil)
+			if err := m1.UseBus(b1); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= 3; i++ {
+				if err := m1.publish("numbered", FeedNotification{Action: "empty"}); err != nil {
+					t.Fatal(err)
+				}
+				waitForSeq(t, m1, "numbered", uint64(i))
+			}
+
+			// A replica subscribing later gets the same sequences
+			m2 := NewWebSocketManager(nil)
+			if err := m2.UseBus(b2); err != nil {
+				t.Fatal(err)
+			}
+			if err := m1.publish("numbered", FeedNotification{Action: "empty"}); err != nil {
+				t.Fatal(err)
+			}
+			waitForSeq(t, m1, "numbered", 4)
+			waitForSeq(t, m2, "numbered", 4)
+
+			// Notifications published before it subscribed require a resync
+			since := uint64(2)
+			if r := m2.Poll(context.Background(), "numbered", &since, 5*time.Second); !r.Resync || r.Seq != 4 {
+				t.Errorf("Expect resync but got %+v", r)
+			}
+
+			// Sequences follow renamed feeds
+			m2.RenameFeed("numbered", "renamed")
+			waitForSeq(t, m1, "renamed", 5)
+			waitForSeq(t, m2, "renamed", 5)
+			if err := m2.publish("renamed", FeedNotification{Action: "empty"}); err != nil {
+				t.Fatal(err)
+			}
+			waitForSeq(t, m1, "renamed", 6)
+			waitForSeq(t, m2, "renamed", 6)
+		})
+	}
+}
+
+func TestBusPresence(t *testing.T) {
+	for name, newBuses := range testBuses {
+		t.Run(name, func(t *testing.T) {
+			b1, b2 := newBuses(t)
+			dir := t.TempDir()
+			m1, fm1 := newReplica(t, dir, b1)
+			m2, fm2 := newReplica(t, dir, b2)
+
+			f1, err := fm1.CreateFeed("present", FeedOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f2, err := fm2.GetFeed("present")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dial := func(m *WebSocketManager, fm *FeedManager, f *Feed, query string) *ws.Conn {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					m.RunSocketForFeed(f, f.Config.Secret, authorizeSecret(fm), w, r)
+				}))
+				t.Cleanup(server.Close)
+				c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?"+query, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			}
+			next := func(c *ws.Conn) FeedNotification {
+				t.Helper()
+				_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+				var n FeedNotification
+				if err := c.ReadJSON(&n); err != nil {
+					t.Fatal(err)
+				}
+				return n
+			}
+
+			watcher := dial(m1, fm1, f1, "presence=true&device=desktop")
+			defer watcher.Close()
+			if n := next(watcher); n.Action != ActionJoin || n.Device == nil || n.Device.Name != "desktop" {
+				t.Fatalf("Expect own join but got %+v", n)
+			}
+
+			// Devices connected to a replica are notified and listed on
+			// the others
+			laptop := dial(m2, fm2, f2, "device=laptop")
+			n := next(watcher)
+			if n.Action != ActionJoin || n.Device == nil || n.Device.Name != "laptop" {
+				t.Fatalf("Expect laptop join but got %+v", n)
+			}
+			for _, m := range []*WebSocketManager{m1, m2} {
+				presence, err := m.Presence("present")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(presence) != 2 || presence[0].Name != "desktop" || presence[1].Name != "laptop" {
+					t.Fatalf("Unexpected presence %+v", presence)
+				}
+			}
+			waitForCount(t, m1, "present", 2)
+
+			// Presence follows renamed feeds
+			m2.RenameFeed("present", "moved")
+			if n := next(watcher); n.Action != ActionRenamed {
+				t.Fatalf("Expect renamed but got %+v", n)
+			}
+			waitForCount(t, m1, "moved", 2)
+			waitForCount(t, m2, "present", 0)
+
+			laptop.Close()
+			if n := next(watcher); n.Action != ActionLeave || n.Device == nil || n.Device.Name != "laptop" {
+				t.Fatalf("Expect laptop leave but got %+v", n)
+			}
+			waitForCount(t, m2, "moved", 1)
+		})
+	}
+}
+
+func TestRedisBusPublishFailure(t *testing.T) {
+	s := miniredis.RunT(t)
+	b, err := NewRedisBus("redis://"+s.Addr(), DefaultBusChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	_, fm := newReplica(t, t.TempDir(), b)
+	f, err := fm.CreateFeed("unreachable", FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Items are added even if clients can't be notified
+	s.Close()
+	if err = f.AddItem("text/plain", "", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.GetPublicItem("Pasted Text.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedisBusInvalidURL(t *testing.T) {
+	if _, err := NewRedisBus("foo://bar", DefaultBusChannel); err == nil {
+		t.Fatal("Expect error with invalid URL")
+	}
+}
@@ -0,0 +1,214 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+// Commands accepted as JSON messages on websockets
+const (
+	CommandAdd    = "add"
+	CommandDelete = "delete"
+	CommandPIN    = "pin"
+	CommandItems  = "items"
+
+	// Websockets connected to several feeds subscribe to each of them
+	CommandSubscribe   = "subscribe"
+	CommandUnsubscribe = "unsubscribe"
+)
+
+// Default and maximum number of items returned by the items command
+const (
+	DefaultItemsLimit = 50
+	MaxItemsLimit     = 500
+)
+
+// Command is a request sent by a websocket client as a JSON message. ID is
+// chosen by the client and echoed in the response.
+type Command struct {
+	ID      string `json:"id"`
+	Command string `json:"command"`
+
+	// Feed is the feed the command applies to, on websockets connected to
+	// several feeds
+	Feed string `json:"feed,omitempty"`
+
+	// Secret authenticates the client to the feed it subscribes to, and
+	// Since is the sequence of the last notification it received
+	Secret string  `json:"secret,omitempty"`
+	Since  *uint64 `json:"since,omitempty"`
+
+	// Text is the content of the item to add
+	Text string `json:"text,omitempty"`
+
+	// Item is the name of the item to delete
+	Item string `json:"item,omitempty"`
+
+	// PIN is the PIN to set on the feed
+	PIN string `json:"pin,omitempty"`
+
+	// Offset and Limit select a page of items, most recent first
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+}
+
+// CommandError is the error returned when a command fails, Code follows
+// HTTP status codes
+type CommandError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+// CommandResponse is sent to the websocket client for each command, with
+// either a Result or an Error
+type CommandResponse struct {
+	ID      string        `json:"id"`
+	Command string        `json:"command"`
+	Result  any           `json:"result,omitempty"`
+	Error   *CommandError `json:"error,omitempty"`
+}
+
+// ItemResult is the result of the add and delete commands
+type ItemResult struct {
+	Item *PublicFeedItem `json:"item"`
+}
+
+// ItemsResult is the result of the items command, Total is the number of
+// items in the feed
+type ItemsResult struct {
+	Items  []PublicFeedItem `json:"items"`
+	Offset int              `json:"offset"`
+	Total  int              `json:"total"`
+}
+
+// isCommand returns true if data is a JSON command rather than one of the
+// plain text commands
+func isCommand(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "{")
+}
+
+// runCommand executes the JSON command in data, and returns the response to
+// send. load returns the feed the command applies to, read from disk, and
+// the scopes granted to the client.
+func (m *WebSocketManager) runCommand(load func() (*Feed, Scopes, error), data []byte) CommandResponse {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return commandFailed(cmd, http.StatusBadRequest, "invalid command")
+	}
+
+	f, scopes, err := load()
+	if err != nil {
+		cerr := asCommandError(err)
+		return commandFailed(cmd, cerr.Code, cerr.Message)
+	}
+
+	wsL.Logger.Debug("Running command",
+		slog.String("feedName", f.Name()),
+		slog.String("id", cmd.ID),
+		slog.String("command", cmd.Command))
+
+	switch cmd.Command {
+	case CommandAdd:
+		if !scopes.Has(ScopeWrite) {
+			return commandFailed(cmd, http.StatusForbidden, "write scope required")
+		}
+		if m.MaxItemSize > 0 && int64(len(cmd.Text)) > m.MaxItemSize {
+			return commandFailed(cmd, http.StatusRequestEntityTooLarge, FeedErrorMaxBodySizeExceeded.Error())
+		}
+		item, err := f.addItem("text/plain", "", strings.NewReader(cmd.Text))
+		if err != nil {
+			if errors.Is(err, FeedErrorItemEmpty) {
+				return commandFailed(cmd, http.StatusBadRequest, FeedErrorItemEmpty.Error())
+			}
+			return commandError(cmd, err)
+		}
+		return CommandResponse{ID: cmd.ID, Command: cmd.Command, Result: ItemResult{Item: item}}
+
+	case CommandDelete:
+		if !scopes.Has(ScopeDelete) {
+			return commandFailed(cmd, http.StatusForbidden, "delete scope required")
+		}
+		item, err := f.GetPublicItem(cmd.Item)
+		if err == nil {
+			err = f.RemoveItem(cmd.Item, true)
+		}
+		if err != nil {
+			if errors.Is(err, FeedErrorItemNotFound) {
+				return commandFailed(cmd, http.StatusNotFound, "item does not exist")
+			}
+			return commandError(cmd, err)
+		}
+		return CommandResponse{ID: cmd.ID, Command: cmd.Command, Result: ItemResult{Item: item}}
+
+	case CommandPIN:
+		if !scopes.Has(ScopeAdmin) {
+			return commandFailed(cmd, http.StatusForbidden, "admin scope required")
+		}
+		if err := f.SetPIN(cmd.PIN); err != nil {
+			if errors.Is(err, FeedConfigErrorPinIncorrectLength) {
+				return commandFailed(cmd, http.StatusBadRequest, "PIN should be 4 digits")
+			}
+			return commandError(cmd, err)
+		}
+		return CommandResponse{ID: cmd.ID, Command: cmd.Command, Result: struct{}{}}
+
+	case CommandItems:
+		if !scopes.Has(ScopeRead) {
+			return commandFailed(cmd, http.StatusForbidden, "read scope required")
+		}
+		if cmd.Offset < 0 || cmd.Limit < 0 || cmd.Limit > MaxItemsLimit {
+			return commandFailed(cmd, http.StatusBadRequest, "invalid offset or limit")
+		}
+		limit := cmd.Limit
+		if limit == 0 {
+			limit = DefaultItemsLimit
+		}
+		items, err := f.publicItems()
+		if err != nil {
+			return commandError(cmd, err)
+		}
+		result := ItemsResult{Items: []PublicFeedItem{}, Offset: cmd.Offset, Total: len(items)}
+		if cmd.Offset < len(items) {
+			result.Items = items[cmd.Offset:min(cmd.Offset+limit, len(items))]
+		}
+		return CommandResponse{ID: cmd.ID, Command: cmd.Command, Result: result}
+	}
+
+	return commandFailed(cmd, http.StatusBadRequest, "unknown command")
+}
+
+// commandFailed returns a response to cmd with an error
+func commandFailed(cmd Command, code int, message string) CommandResponse {
+	return CommandResponse{
+		ID:      cmd.ID,
+		Command: cmd.Command,
+		Error:   &CommandError{Code: code, Message: message},
+	}
+}
+
+// asCommandError returns err if it is a *CommandError, or an internal error
+// otherwise
+func asCommandError(err error) *CommandError {
+	var cerr *CommandError
+	if !errors.As(err, &cerr) {
+		cerr = &CommandError{Code: http.StatusInternalServerError, Message: err.Error()}
+	}
+	return cerr
+}
+
+// commandError returns a response to cmd for an unexpected error
+func commandError(cmd Command, err error) CommandResponse {
+	wsL.Logger.Error("Command failed",
+		slog.String("id", cmd.ID),
+		slog.String("command", cmd.Command),
+		slog.String("error", err.Error()))
+	return commandFailed(cmd, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,256 @@
+package feed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// sendCommand sends cmd on c and returns its response, skipping
+// notifications
+func sendCommand(t *testing.T, c *ws.Conn, cmd Command) CommandResponse {
+	t.Helper()
+	if err := c.WriteJSON(cmd); err != nil {
+		t.Fatal(err)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r struct {
+			CommandResponse
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.ID == "" {
+			continue
+		}
+		if r.ID != cmd.ID {
+			t.Fatalf("Expect response to %s but got %s", cmd.ID, r.ID)
+		}
+		r.CommandResponse.Result = r.Result
+		return r.CommandResponse
+	}
+}
+
+func TestWebSocketCommands(t *testing.T) {
+	m, f, _ := newWebSocketServer(t)
+	m.MaxItemSize = 16
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes := Scopes{}
+		for _, s := range strings.Split(r.URL.Query().Get("scopes"), ",") {
+			scopes = append(scopes, Scope(s))
+		}
+		token, err := f.Config.AddToken("commands", scopes)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		m.RunSocketForFeed(f, token.Token, authorizeSecret(m.FeedManager), w, r)
+	}))
+	defer server.Close()
+
+	dial := func(scopes string) *ws.Conn {
+		u := "ws" + strings.TrimPrefix(server.URL, "http") + "?scopes=" + scopes
+		c, _, err := ws.DefaultDialer.Dial(u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := dial("read,write,delete,admin")
+	defer c.Close()
+
+	// Add items
+	for i := 0; i < 3; i++ {
+		r := sendCommand(t, c, Command{ID: fmt.Sprintf("add-%d", i), Command: CommandAdd, Text: "hello"})
+		if r.Error != nil {
+			t.Fatalf("Unexpected error %v", r.Error)
+		}
+		var result ItemResult
+		if err := json.Unmarshal(r.Result.(json.RawMessage), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Item == nil || result.Item.Type != Text {
+			t.Fatalf("Expect text item but got %v", result.Item)
+		}
+		// Items are sorted by modification time
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Paginate items
+	r := sendCommand(t, c, Command{ID: "items", Command: CommandItems, Offset: 1, Limit: 1})
+	var items ItemsResult
+	if err := json.Unmarshal(r.Result.(json.RawMessage), &items); err != nil {
+		t.Fatal(err)
+	}
+	if items.Total != 3 || len(items.Items) != 1 || items.Items[0].Name != "Pasted Text 1.txt" {
+		t.Fatalf("Unexpected items page %+v", items)
+	}
+	r = sendCommand(t, c, Command{ID: "items-end", Command: CommandItems, Offset: 5})
+	if err := json.Unmarshal(r.Result.(json.RawMessage), &items); err != nil {
+		t.Fatal(err)
+	}
+	if items.Total != 3 || len(items.Items) != 0 {
+		t.Fatalf("Unexpected items page %+v", items)
+	}
+
+	// Delete an item
+	r = sendCommand(t, c, Command{ID: "delete", Command: CommandDelete, Item: "Pasted Text.txt"})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+	r = sendCommand(t, c, Command{ID: "delete-again", Command: CommandDelete, Item: "Pasted Text.txt"})
+	if r.Error == nil || r.Error.Code != http.StatusNotFound {
+		t.Fatalf("Expect not found error but got %v", r.Error)
+	}
+
+	// Set PIN
+	r = sendCommand(t, c, Command{ID: "pin", Command: CommandPIN, PIN: "1234"})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+	saved, err := m.FeedManager.GetFeed(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = saved.ScopesForSecret("1234"); err != nil {
+		t.Fatal(err)
+	}
+	r = sendCommand(t, c, Command{ID: "bad-pin", Command: CommandPIN, PIN: "12"})
+	if r.Error == nil || r.Error.Code != http.StatusBadRequest {
+		t.Fatalf("Expect bad request error but got %v", r.Error)
+	}
+
+	// Invalid commands
+	tests := map[string]struct {
+		command Command
+		code    int
+	}{
+		"unknown":  {Command{ID: "unknown", Command: "unknown"}, http.StatusBadRequest},
+		"empty":    {Command{ID: "empty", Command: CommandAdd}, http.StatusBadRequest},
+		"too-big":  {Command{ID: "too-big", Command: CommandAdd, Text: strings.Repeat("a", 17)}, http.StatusRequestEntityTooLarge},
+		"limit":    {Command{ID: "limit", Command: CommandItems, Limit: MaxItemsLimit + 1}, http.StatusBadRequest},
+		"negative": {Command{ID: "negative", Command: CommandItems, Offset: -1}, http.StatusBadRequest},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := sendCommand(t, c, test.command)
+			if r.Error == nil || r.Error.Code != test.code {
+				t.Fatalf("Expect error %d but got %v", test.code, r.Error)
+			}
+		})
+	}
+
+	// Plain text commands still work
+	if err := c.WriteMessage(ws.TextMessage, []byte("feed")); err != nil {
+		t.Fatal(err)
+	}
+	var wf websocketFeed
+	if err := c.ReadJSON(&wf); err != nil {
+		t.Fatal(err)
+	}
+	if len(wf.Items) != 2 {
+		t.Fatalf("Expect 2 items but got %d", len(wf.Items))
+	}
+}
+
+func TestWebSocketCommandsScopes(t *testing.T) {
+	_, _, server := newWebSocketServer(t)
+
+	c := dialWebSocket(t, server)
+	defer c.Close()
+
+	for _, command := range []string{CommandAdd, CommandDelete, CommandPIN} {
+		r := sendCommand(t, c, Command{ID: command, Command: command, Text: "hello", Item: "item.txt", PIN: "1234"})
+		if r.Error == nil || r.Error.Code != http.StatusForbidden {
+			t.Fatalf("Expect forbidden error for %s but got %v", command, r.Error)
+		}
+	}
+
+	r := sendCommand(t, c, Command{ID: "items", Command: CommandItems})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+
+	// Malformed commands get an error without id
+	if err := c.WriteMessage(ws.TextMessage, []byte("{invalid")); err != nil {
+		t.Fatal(err)
+	}
+	var resp CommandResponse
+	if err := c.ReadJSON(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != http.StatusBadRequest {
+		t.Fatalf("Expect bad request error but got %v", resp.Error)
+	}
+}
+
+func TestWebSocketCommandsReloadFeed(t *testing.T) {
+	m, f, _ := newWebSocketServer(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.RunSocketForFeed(f, f.Config.Secret, authorizeSecret(m.FeedManager), w, r)
+	}))
+	defer server.Close()
+
+	c := dialWebSocket(t, server)
+	defer c.Close()
+
+	// Configuration changes made after the websocket connected are kept
+	other, err := m.FeedManager.GetFeed(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := other.Config.AddToken("added", Scopes{ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := sendCommand(t, c, Command{ID: "pin", Command: CommandPIN, PIN: "1234"})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+
+	saved, err := m.FeedManager.GetFeed(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = saved.ScopesForSecret(token.Token); err != nil {
+		t.Errorf("Token added after connecting has been lost: %v", err)
+	}
+
+	// The previous secret doesn't grant access anymore once rotated
+	if err = other.Config.RotateSecret(); err != nil {
+		t.Fatal(err)
+	}
+	secret := other.Config.Secret
+
+	r = sendCommand(t, c, Command{ID: "pin-rotated", Command: CommandPIN, PIN: "5678"})
+	if r.Error == nil || r.Error.Code != http.StatusUnauthorized {
+		t.Fatalf("Expect unauthorized error but got %v", r.Error)
+	}
+
+	saved, err = m.FeedManager.GetFeed(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Config.Secret != secret {
+		t.Errorf("Rotated secret has been reverted")
+	}
+	if err = saved.Config.PIN.IsValid("1234"); err != nil {
+		t.Errorf("Expect PIN 1234 but got %v", err)
+	}
+}
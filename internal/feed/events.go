@@ -0,0 +1,131 @@
+package feed
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultEventLogSize is the number of notifications kept for each feed so
+// that reconnecting clients can catch up
+const DefaultEventLogSize = 256
+
+// eventLog is a bounded log of the last notifications of a feed, numbered
+// with a sequence incremented for each notification. The log only holds
+// consecutive notifications.
+type eventLog struct {
+	seq    uint64
+	events []FeedNotification // ring buffer, oldest at start
+	start  int
+
+	// wait is closed when a notification is added
+	wait chan struct{}
+}
+
+// newEventLog returns an eventLog keeping size notifications
+func newEventLog(size int) *eventLog {
+	return &eventLog{
+		events: make([]FeedNotification, 0, size),
+		wait:   make(chan struct{}),
+	}
+}
+
+// add appends n to the log, dropping the oldest notification when the log
+// is full. Notifications received from a bus are already numbered, others
+// get the next sequence. When n doesn't follow the last notification, the
+// ones in between were missed and the log restarts from n, so that clients
+// resuming from before n receive a resync.
+func (l *eventLog) add(n FeedNotification) FeedNotification {
+	if n.Seq == 0 {
+		n.Seq = l.seq + 1
+	}
+	if n.Seq != l.seq+1 {
+		l.events = l.events[:0]
+		l.start = 0
+	}
+	l.seq = n.Seq
+
+	close(l.wait)
+	l.wait = make(chan struct{})
+
+	if len(l.events) < cap(l.events) {
+		l.events = append(l.events, n)
+	} else if len(l.events) > 0 {
+		l.events[l.start] = n
+		l.start = (l.start + 1) % len(l.events)
+	}
+
+	return n
+}
+
+// since returns notifications following sequence seq. It returns false if
+// some of them are not in the log anymore, or seq is unknown.
+func (l *eventLog) since(seq uint64) ([]FeedNotification, bool) {
+	if seq > l.seq {
+		return nil, false
+	}
+
+	missed := l.seq - seq
+	if missed > uint64(len(l.events)) {
+		return nil, false
+	}
+
+	result := make([]FeedNotification, 0, missed)
+	for i := len(l.events) - int(missed); i < len(l.events); i++ {
+		result = append(result, l.events[(l.start+i)%len(l.events)])
+	}
+	return result, true
+}
+
+// Long polling settings
+const (
+	DefaultPollTimeout = 30 * time.Second
+	MaxPollTimeout     = 2 * time.Minute
+)
+
+// PollResult is the result of a long polling request. Seq is the sequence
+// to poll from next time. When Resync is true, notifications were lost and
+// the client should download the feed again.
+type PollResult struct {
+	Seq           uint64             `json:"seq"`
+	Resync        bool               `json:"resync,omitempty"`
+	Notifications []FeedNotification `json:"notifications"`
+}
+
+// Poll returns the notifications of feed feedName following sequence
+// since, waiting up to timeout for one if there are none yet. When since
+// is nil, only notifications following the current sequence are returned.
+func (m *WebSocketManager) Poll(ctx context.Context, feedName string, since *uint64, timeout time.Duration) PollResult {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	m.mutex.Lock()
+	seq := m.eventLog(feedName).seq
+	if since != nil {
+		seq = *since
+	}
+	m.mutex.Unlock()
+
+	for {
+		m.mutex.Lock()
+		l := m.eventLog(feedName)
+		events, ok := l.since(seq)
+		wait := l.wait
+		current := l.seq
+		m.mutex.Unlock()
+
+		switch {
+		case !ok:
+			return PollResult{Seq: current, Resync: true, Notifications: []FeedNotification{}}
+		case len(events) > 0:
+			return PollResult{Seq: current, Notifications: events}
+		}
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			return PollResult{Seq: current, Notifications: []FeedNotification{}}
+		case <-ctx.Done():
+			return PollResult{Seq: current, Notifications: []FeedNotification{}}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package feed
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEventLog(t *testing.T) {
+	l := newEventLog(3)
+
+	if events, ok := l.since(0); !ok || len(events) != 0 {
+		t.Errorf("Expect no events but got %v, %v", events, ok)
+	}
+
+	for i := 0; i < 5; i++ {
+		n := l.add(FeedNotification{Action: "add"})
+		if n.Seq != uint64(i+1) {
+			t.Errorf("Expect sequence %d but got %d", i+1, n.Seq)
+		}
+	}
+
+	tests := []struct {
+		since uint64
+		seqs  []uint64
+		ok    bool
+	}{
+		{5, []uint64{}, true},
+		{4, []uint64{5}, true},
+		{2, []uint64{3, 4, 5}, true},
+		{1, nil, false},
+		{6, nil, false},
+	}
+
+	for _, test := range tests {
+		events, ok := l.since(test.since)
+		if ok != test.ok {
+			t.Errorf("since %d: expect %v but got %v", test.since, test.ok, ok)
+			continue
+		}
+		if len(events) != len(test.seqs) {
+			t.Errorf("since %d: expect %v but got %v", test.since, test.seqs, events)
+			continue
+		}
+		for i, e := range events {
+			if e.Seq != test.seqs[i] {
+				t.Errorf("since %d: expect %v but got %v", test.since, test.seqs, events)
+			}
+		}
+	}
+}
+
+func TestEventLogMissedNotifications(t *testing.T) {
+	l := newEventLog(3)
+	l.add(FeedNotification{Action: "add", Seq: 1})
+	l.add(FeedNotification{Action: "add", Seq: 2})
+
+	// Notifications 3 and 4 were missed
+	l.add(FeedNotification{Action: "add", Seq: 5})
+	if events, ok := l.since(2); ok {
+		t.Errorf("Expect resync but got %v", events)
+	}
+	if events, ok := l.since(4); !ok || len(events) != 1 || events[0].Seq != 5 {
+		t.Errorf("Expect notification 5 but got %v, %v", events, ok)
+	}
+
+	// Sequence restarted
+	l.add(FeedNotification{Action: "add", Seq: 1})
+	if events, ok := l.since(5); ok {
+		t.Errorf("Expect resync but got %v", events)
+	}
+	if events, ok := l.since(0); !ok || len(events) != 1 || events[0].Seq != 1 {
+		t.Errorf("Expect notification 1 but got %v, %v", events, ok)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	m := NewWebSocketManager(nil)
+	ctx := context.Background()
+
+	r := m.Poll(ctx, "poll", nil, 10*time.Millisecond)
+	if r.Seq != 0 || r.Resync || len(r.Notifications) != 0 {
+		t.Errorf("Expect empty result but got %+v", r)
+	}
+
+	// Polling waits for the next notification
+	done := make(chan PollResult)
+	go func() {
+		done <- m.Poll(ctx, "poll", nil, 5*time.Second)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := m.broadcast("poll", FeedNotification{Action: "empty"}); err != nil {
+		t.Fatal(err)
+	}
+	r = <-done
+	if r.Seq != 1 || len(r.Notifications) != 1 || r.Notifications[0].Action != "empty" {
+		t.Errorf("Expect empty notification but got %+v", r)
+	}
+
+	// Missed notifications are returned immediately
+	if err := m.broadcast("poll", FeedNotification{Action: "empty"}); err != nil {
+		t.Fatal(err)
+	}
+	since := uint64(0)
+	r = m.Poll(ctx, "poll", &since, 5*time.Second)
+	if r.Seq != 2 || len(r.Notifications) != 2 {
+		t.Errorf("Expect 2 notifications but got %+v", r)
+	}
+
+	// Unknown sequences require a resync
+	since = 42
+	r = m.Poll(ctx, "poll", &since, 5*time.Second)
+	if !r.Resync || r.Seq != 2 {
+		t.Errorf("Expect resync but got %+v", r)
+	}
+
+	// Polling stops with the request
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	since = 2
+	r = m.Poll(cctx, "poll", &since, 5*time.Second)
+	if len(r.Notifications) != 0 {
+		t.Errorf("Expect no notifications but got %+v", r)
+	}
+}
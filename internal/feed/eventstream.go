@@ -0,0 +1,89 @@
+package feed
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// RunEventStreamForFeed sends notifications of feed f to the client as
+// server-sent events, an alternative to websockets for networks blocking
+// them. Clients reconnecting with a Last-Event-ID header receive the
+// notifications they missed. This function is blocking and typically runs
+// from a http handler, once the client has been granted read scope on f.
+func (m *WebSocketManager) RunEventStreamForFeed(f *Feed, w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	c := m.newSubscriber()
+	c.identify(r)
+
+	m.mutex.Lock()
+	feedSockets := m.registerLocked(f.Name(), c)
+	slow := false
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		if seq, err := strconv.ParseUint(id, 10, 64); err == nil {
+			slow = m.resumeLocked(feedSockets, c, seq)
+		}
+	}
+	m.mutex.Unlock()
+
+	m.join(f.Name(), c)
+
+	// Cleanup
+	defer func() {
+		m.unregister(feedSockets, c)
+		c.stop(0, "")
+	}()
+
+	if slow {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable buffering in nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		wsL.Logger.Error("Unable to stream events", slog.String("error", err.Error()))
+		return
+	}
+
+	writeTimeout := durationOrDefault(m.WriteTimeout, DefaultWriteTimeout)
+
+	// Comments keep the connection alive through proxies, and detect
+	// clients that are gone
+	ticker := time.NewTicker(durationOrDefault(m.PingInterval, DefaultPingInterval))
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case msg := <-c.send:
+			_ = rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if msg.seq != 0 {
+				_, err = fmt.Fprintf(w, "id: %d\n", msg.seq)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "data: %s\n\n", msg.data)
+			}
+		case <-ticker.C:
+			_ = rc.SetWriteDeadline(time.Now().Add(writeTimeout))
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case <-c.done:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			wsL.Logger.Debug("Unable to write event", slog.String("error", err.Error()))
+			return
+		}
+	}
+}
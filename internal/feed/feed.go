@@ -22,11 +22,15 @@ import (
 // PublicFeed is a version of a feed meant to provide a json representation of
 // a feed that does not expose private informations
 // In this context, the feed secret is not a private information as it needs to
-// be transmitted as a cookie to the browser
+// be transmitted as a cookie to the browser, but it is only provided to
+// clients holding the admin scope
 type PublicFeed struct {
 	Name           string           `json:"name"`
+	Description    string           `json:"description,omitempty"`
+	Retention      Duration         `json:"retention,omitempty"`
 	Items          []PublicFeedItem `json:"items"`
-	Secret         string           `json:"secret"`
+	Secret         string           `json:"secret,omitempty"`
+	Scopes         Scopes           `json:"scopes,omitempty"`
 	VAPIDPublicKey string           `json:"vapidpublickey"`
 }
 
@@ -123,6 +127,9 @@ func NewFeed(feedPath string) (*Feed, error) {
 
 	// Create feed directory
 	err = os.Mkdir(feedPath, 0700)
+	if errors.Is(err, os.ErrExist) {
+		return nil, FeedErrorAlreadyExists
+	}
 	if err != nil {
 		fL.Logger.Error("Error creating feed directory", slog.String("directory", feedPath))
 		return nil, err
@@ -178,20 +185,37 @@ func (feed *Feed) Name() string {
 	return path.Base(feed.Path)
 }
 
+// isInternalFile returns true if name is a file used by ybFeed to store the
+// feed configuration rather than a feed item
+func isInternalFile(name string) bool {
+	return name == "secret" || name == "pin" || name == "config.json" || name == configTempFile
+}
+
 // Public returns a marshalable representation of a feed, that can be returned
-// to the client as a result to an API call or in a websocket.
-func (feed *Feed) Public() (*PublicFeed, error) {
+// to the client as a result to an API call or in a websocket. Content is
+// filtered according to the scopes granted to the client.
+func (feed *Feed) Public(scopes Scopes) (*PublicFeed, error) {
+	// Prepare the PublicFeed struct that will be returned
+	result := &PublicFeed{
+		Name:        feed.Name(),
+		Description: feed.Config.Description,
+		Retention:   feed.Config.Retention,
+		Items:       []PublicFeedItem{},
+		Scopes:      scopes,
+	}
+
 	// Get all public items for the feed
-	items, err := feed.publicItems()
-	if err != nil {
-		return nil, err
+	if scopes.Has(ScopeRead) {
+		items, err := feed.publicItems()
+		if err != nil {
+			return nil, err
+		}
+		result.Items = items
 	}
 
-	// Prepare the PublicFeed struct that will be returned
-	result := &PublicFeed{
-		Name:   feed.Name(),
-		Items:  items,
-		Secret: feed.Config.Secret,
+	// Only administrators get the feed secret
+	if scopes.Has(ScopeAdmin) {
+		result.Secret = feed.Config.Secret
 	}
 
 	// Add the necessary web push notification public key for the browser
@@ -218,7 +242,7 @@ func (feed *Feed) publicItems() ([]PublicFeedItem, error) {
 
 	// Parse feed directory content, ignoring internal files
 	for _, f := range d {
-		if f.Name() == "secret" || f.Name() == "pin" || f.Name() == "config.json" {
+		if isInternalFile(f.Name()) {
 			continue
 		}
 		info, err := f.Info()
@@ -259,16 +283,88 @@ func (feed *Feed) Empty() error {
 	// Notify all connected websockets
 	if feed.WebSocketManager != nil {
 		if err = feed.WebSocketManager.NotifyEmpty(feed); err != nil {
-			return err
+			fL.Logger.Error("Unable to notify feed emptied", slog.String("feed", feed.Path), slog.String("error", err.Error()))
 		}
 	}
 
 	return nil
 }
 
+// FeedStats contains usage statistics of a feed
+type FeedStats struct {
+	Name         string    `json:"name"`
+	Items        int       `json:"items"`
+	Bytes        int64     `json:"bytes"`
+	LastActivity time.Time `json:"lastactivity"`
+	Subscribers  int       `json:"subscribers"`
+	WebSockets   int       `json:"websockets"`
+}
+
+// Stats returns usage statistics of the feed. Last activity is the most
+// recent change to items or configuration.
+func (feed *Feed) Stats() (*FeedStats, error) {
+	result := &FeedStats{
+		Name:        feed.Name(),
+		Subscribers: len(feed.Config.Subscriptions),
+	}
+
+	d, err := os.ReadDir(feed.Path)
+	if err != nil {
+		return nil, FeedErrorUnableToReadContent
+	}
+
+	for _, f := range d {
+		info, err := f.Info()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", FeedErrorUnableToReadItemInfo, path.Join(feed.Path, f.Name()))
+		}
+		if info.ModTime().After(result.LastActivity) {
+			result.LastActivity = info.ModTime()
+		}
+		if isInternalFile(f.Name()) {
+			continue
+		}
+		result.Items++
+		result.Bytes += info.Size()
+	}
+
+	if feed.WebSocketManager != nil {
+		result.WebSockets = feed.WebSocketManager.Count(feed.Name())
+	}
+
+	return result, nil
+}
+
+// ExpireItems removes items older than the feed retention and returns the
+// number of items removed. Nothing is removed if the feed has no retention.
+func (feed *Feed) ExpireItems(now time.Time) (int, error) {
+	if feed.Config.Retention <= 0 {
+		return 0, nil
+	}
+
+	items, err := feed.publicItems()
+	if err != nil {
+		return 0, err
+	}
+
+	limit := now.Add(-time.Duration(feed.Config.Retention))
+	count := 0
+	for _, item := range items {
+		if item.Date.After(limit) {
+			continue
+		}
+		if err = feed.RemoveItem(item.Name, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
 // GetPublicItem returns a marshable struct for a specific feed item
 func (feed *Feed) GetPublicItem(i string) (*PublicFeedItem, error) {
-	if i == "secret" || i == "pin" || i == "config.json" {
+	if isInternalFile(i) {
 		return nil, FeedErrorInvalidFeedItem
 	}
 
@@ -286,12 +382,29 @@ func (feed *Feed) GetPublicItem(i string) (*PublicFeedItem, error) {
 		Date: s.ModTime(),
 		Type: GetItemType(i),
 		Feed: &PublicFeed{
-			Name:   feed.Name(),
-			Secret: feed.Config.Secret,
+			Name: feed.Name(),
 		},
 	}, nil
 }
 
+// ItemFingerprint returns a value identifying the current content of item,
+// which changes when it is replaced by another item with the same name
+func (feed *Feed) ItemFingerprint(i string) (string, error) {
+	if isInternalFile(i) {
+		return "", FeedErrorInvalidFeedItem
+	}
+
+	s, err := os.Stat(path.Join(feed.Path, path.Join("/", i)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s", FeedErrorItemNotFound, i)
+		}
+		return "", err
+	}
+
+	return fmt.Sprintf("%d-%d", s.ModTime().UnixNano(), s.Size()), nil
+}
+
 // GetItemData returns the content of a specific feed item
 func (feed *Feed) GetItemData(item string) ([]byte, error) {
 	fL.Logger.Debug("Getting Item", slog.String("feed", feed.Path), slog.String("name", item))
@@ -300,7 +413,7 @@ func (feed *Feed) GetItemData(item string) ([]byte, error) {
 	// Get path to feed item
 	filePath := path.Join(feed.Path, path.Join("/"+item))
 
-	if path.Base(filePath) == "secret" || path.Base(filePath) == "pin" || path.Base(filePath) == "config.json" {
+	if isInternalFile(path.Base(filePath)) {
 		return nil, fmt.Errorf("%w: %s", FeedErrorItemNotFound, item)
 	}
 	// Read feed item content
@@ -318,29 +431,19 @@ func (feed *Feed) GetItemData(item string) ([]byte, error) {
 // IsSecretValid returns an error if the provided secret doesn't allow access
 // to the feed. secret can be a full secret or a PIN
 func (feed *Feed) IsSecretValid(secret string) error {
-	if secret == "" {
-		return FeedErrorInvalidSecret
-	}
-
-	if len(secret) == 4 { // Secret is a PIN
-		err := feed.Config.PIN.IsValid(secret)
-		if err != nil {
-			fL.Logger.Error(err.Error())
-			return err
-		}
-	} else {
-		if feed.Config.Secret != secret {
-			fL.Logger.Error(FeedErrorIncorrectSecret.Error())
-			return FeedErrorIncorrectSecret
-		}
-	}
-
-	return nil
+	_, err := feed.ScopesForSecret(secret)
+	return err
 }
 
 // AddItem reads content from r and creates a new file in the feed directory
 // with a name and file extension based on contentType, then notifies clients
 func (f *Feed) AddItem(contentType string, filename string, r io.Reader) error {
+	_, err := f.addItem(contentType, filename, r)
+	return err
+}
+
+// addItem implements AddItem and returns the item created
+func (f *Feed) addItem(contentType string, filename string, r io.Reader) (*PublicFeedItem, error) {
 	fL.Logger.Debug("Adding Item", slog.String("feed", f.Name()), slog.String("content-type", contentType))
 
 	var err error
@@ -355,6 +458,9 @@ func (f *Feed) AddItem(contentType string, filename string, r io.Reader) error {
 	// If the content-type isn't found, return an error
 	info, ok := mimeInfos[contentType]
 	if !ok {
+		if path.Ext(filename) == "" {
+			return nil, fmt.Errorf("%w: %s", FeedErrorInvalidContentType, contentType)
+		}
 		info = FileTypeInfo{
 			FileExtension:    path.Ext(filename)[1:],
 			FileNameTemplate: filename[:len(filename)-len(path.Ext(filename))],
@@ -371,14 +477,14 @@ func (f *Feed) AddItem(contentType string, filename string, r io.Reader) error {
 	if err != nil {
 		e, ok := err.(*http.MaxBytesError)
 		if ok {
-			return fmt.Errorf("%w: %d", FeedErrorMaxBodySizeExceeded, e.Limit)
+			return nil, fmt.Errorf("%w: %d", FeedErrorMaxBodySizeExceeded, e.Limit)
 		}
-		return err
+		return nil, err
 	}
 
 	// Check the content is not empty
 	if len(content) == 0 {
-		return fmt.Errorf("%w: %s %s", FeedErrorItemEmpty, f.Path, template)
+		return nil, fmt.Errorf("%w: %s %s", FeedErrorItemEmpty, f.Path, template)
 	}
 
 	// Search for existing content with identical file type to increment
@@ -392,7 +498,7 @@ func (f *Feed) AddItem(contentType string, filename string, r io.Reader) error {
 		filename = fmt.Sprintf("%s%s", template, fileIndexStr)
 		matches, err := filepath.Glob(path.Join(f.Path, filename) + ".*")
 		if err != nil {
-			return fmt.Errorf("%w: %s", FeedErrorErrorReading, filename)
+			return nil, fmt.Errorf("%w: %s", FeedErrorErrorReading, filename)
 		}
 		if len(matches) == 0 {
 			break
@@ -406,32 +512,34 @@ func (f *Feed) AddItem(contentType string, filename string, r io.Reader) error {
 	// Write content to file
 	err = os.WriteFile(filePath, content, 0600)
 	if err != nil {
-		return fmt.Errorf("%w: %s", FeedErrorErrorWriting, filePath)
+		return nil, fmt.Errorf("%w: %s", FeedErrorErrorWriting, filePath)
 	}
 
 	// Get PublicItem for the added content
 	publicItem, err := f.GetPublicItem(filename + "." + ext)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Notify additon to all connected browsers
 	if f.WebSocketManager != nil {
+		// The item is added, clients will see it when they download the
+		// feed again
 		if err = f.WebSocketManager.NotifyAdd(publicItem); err != nil {
-			return err
+			fL.Logger.Error("Unable to notify item addition", slog.String("feed", f.Path), slog.String("error", err.Error()))
 		}
 	}
 	// Send push notification to subscribed browsers
 	err = f.sendPushNotification()
 	if err != nil {
 		fL.Logger.Error("Error sending push notification", slog.String("feed", f.Path), slog.String("error", err.Error()))
-		return err
+		return nil, err
 	}
 
 	fL.Logger.Debug("Added Item", slog.String("name", filename+"."+ext), slog.String("feed", f.Path), slog.String("content-type", contentType))
 
-	return nil
+	return publicItem, nil
 }
 
 // RemoveItem deletes item from the feed directory and notifies clients
@@ -458,7 +566,7 @@ func (f *Feed) RemoveItem(item string, notify bool) error {
 	// Notify all connected websockets
 	if f.WebSocketManager != nil && notify {
 		if err = f.WebSocketManager.NotifyRemove(publicItem); err != nil {
-			return err
+			fL.Logger.Error("Unable to notify item removal", slog.String("feed", f.Path), slog.String("error", err.Error()))
 		}
 	}
 
@@ -466,11 +574,13 @@ func (f *Feed) RemoveItem(item string, notify bool) error {
 	return nil
 }
 
-// SetPIN configures the provided pin on the feed
+// SetPIN configures the provided pin on the feed and notifies clients of
+// its expiration
 func (feed *Feed) SetPIN(pin string) error {
 	err := feed.Config.SetPIN(pin)
 	if err != nil {
 		return err
 	}
+	feed.notifySettings(ActionPIN)
 	return nil
 }
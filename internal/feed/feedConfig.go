@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/Appboy/webpush-go"
+	"github.com/google/uuid"
 	"golang.org/x/exp/slog"
 )
 
@@ -18,11 +20,41 @@ var FeedConfigErrorInvalid = errors.New("feed configuration invalid")
 var FeedConfigErrorPinExpired = errors.New("feed pin expired")
 var FeedConfigErrorPinIncorrect = errors.New("feed pin incorrect")
 var FeedConfigErrorPinIncorrectLength = errors.New("feed pin length is not 4")
+var FeedConfigErrorInvalidRetention = errors.New("invalid retention")
+
+// Duration is a time.Duration represented as a string like "24h" in json
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("%w: %s", FeedConfigErrorInvalidRetention, string(b))
+	}
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil || v < 0 {
+		return fmt.Errorf("%w: %s", FeedConfigErrorInvalidRetention, s)
+	}
+	*d = Duration(v)
+	return nil
+}
 
 type FeedConfig struct {
 	Secret        string `json:"secret"`
 	PIN           *PIN   `json:"pin,omitempty"`
 	Subscriptions []webpush.Subscription
+	Tokens        []Token  `json:"tokens,omitempty"`
+	Owner         string   `json:"owner,omitempty"`
+	Members       []Member `json:"members,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Retention     Duration `json:"retention,omitempty"`
 	feed          *Feed
 }
 
@@ -92,10 +124,39 @@ func FeedConfigForFeed(f *Feed) (*FeedConfig, error) {
 	return result, nil
 }
 
+// configTempFile is the file feed configuration is written to before it
+// replaces config.json
+const configTempFile = "config.json.tmp"
+
+// configLocks serializes changes to the configuration of each feed. It maps
+// the path of a config.json file to a *sync.Mutex.
+var configLocks sync.Map
+
+// configLock returns the mutex guarding the configuration at configPath
+func configLock(configPath string) *sync.Mutex {
+	l, _ := configLocks.LoadOrStore(configPath, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
+
+// Write saves feed configuration
 func (config *FeedConfig) Write() error {
 	configPath := path.Join(config.feed.Path, "config.json")
 
-	f, err := os.Create(configPath)
+	l := configLock(configPath)
+	l.Lock()
+	defer l.Unlock()
+
+	return config.write()
+}
+
+// write saves feed configuration to a temporary file and renames it to
+// config.json, so that the configuration is never partially written. The
+// caller must hold the lock of the configuration.
+func (config *FeedConfig) write() error {
+	configPath := path.Join(config.feed.Path, "config.json")
+	tempPath := path.Join(config.feed.Path, configTempFile)
+
+	f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return fmt.Errorf("%w: %s", FeedConfigErrorCantWrite, configPath)
 	}
@@ -104,12 +165,52 @@ func (config *FeedConfig) Write() error {
 	e.SetIndent("", "  ")
 	err = e.Encode(config)
 
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, configPath)
+	}
 	if err != nil {
+		os.Remove(tempPath)
 		return fmt.Errorf("%w: %s", FeedConfigErrorCantWrite, configPath)
 	}
 	return nil
 }
 
+// update reloads feed configuration from disk, applies change to it and
+// saves it. Concurrent updates of the same feed are serialized so that none
+// of them is lost. config holds the saved configuration on success.
+func (config *FeedConfig) update(change func(c *FeedConfig) error) error {
+	configPath := path.Join(config.feed.Path, "config.json")
+
+	l := configLock(configPath)
+	l.Lock()
+	defer l.Unlock()
+
+	current := FeedConfig{feed: config.feed}
+	b, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", FeedConfigErrorNotFound, configPath)
+		}
+		return err
+	}
+	if err = json.Unmarshal(b, &current); err != nil {
+		return fmt.Errorf("%w: %s", FeedConfigErrorInvalid, configPath)
+	}
+
+	if err = change(&current); err != nil {
+		return err
+	}
+	if err = current.write(); err != nil {
+		return err
+	}
+
+	*config = current
+	return nil
+}
+
 func (config *FeedConfig) SetPIN(s string) error {
 	if len(s) != 4 {
 		return FeedConfigErrorPinIncorrectLength
@@ -118,43 +219,54 @@ func (config *FeedConfig) SetPIN(s string) error {
 		PIN:        s,
 		Expiration: time.Now().Add(2 * time.Minute),
 	}
-	config.PIN = pin
-	err := config.Write()
-	if err != nil {
-		return err
-	}
-	return nil
+	return config.update(func(c *FeedConfig) error {
+		c.PIN = pin
+		return nil
+	})
+}
+
+// RotateSecret replaces the feed secret with a new random one and saves
+// feed configuration
+func (config *FeedConfig) RotateSecret() error {
+	return config.update(func(c *FeedConfig) error {
+		c.Secret = uuid.NewString()
+		return nil
+	})
+}
+
+// SetOwner assigns the feed to user
+func (config *FeedConfig) SetOwner(user string) error {
+	return config.update(func(c *FeedConfig) error {
+		c.Owner = user
+		return nil
+	})
 }
 
 func (config *FeedConfig) AddSubscription(s webpush.Subscription) error {
-	for _, t := range config.Subscriptions {
-		if s.Endpoint == t.Endpoint && s.Keys.Auth == t.Keys.Auth && s.Keys.P256dh == t.Keys.P256dh {
-			return nil
+	return config.update(func(c *FeedConfig) error {
+		for _, t := range c.Subscriptions {
+			if s.Endpoint == t.Endpoint && s.Keys.Auth == t.Keys.Auth && s.Keys.P256dh == t.Keys.P256dh {
+				return nil
+			}
 		}
-	}
-	config.Subscriptions = append(config.Subscriptions, s)
-	err := config.Write()
-	if err != nil {
-		return err
-	}
-	return nil
+		c.Subscriptions = append(c.Subscriptions, s)
+		return nil
+	})
 }
 
 func (config *FeedConfig) DeleteSubscription(s webpush.Subscription) error {
-	keepSubscriptions := []webpush.Subscription{}
+	return config.update(func(c *FeedConfig) error {
+		keepSubscriptions := []webpush.Subscription{}
 
-	for _, t := range config.Subscriptions {
-		if s.Endpoint == t.Endpoint && s.Keys.Auth == t.Keys.Auth && s.Keys.P256dh == t.Keys.P256dh {
-			continue
+		for _, t := range c.Subscriptions {
+			if s.Endpoint == t.Endpoint && s.Keys.Auth == t.Keys.Auth && s.Keys.P256dh == t.Keys.P256dh {
+				continue
+			}
+			keepSubscriptions = append(keepSubscriptions, t)
 		}
-		keepSubscriptions = append(keepSubscriptions, t)
-	}
-	config.Subscriptions = keepSubscriptions
-	err := config.Write()
-	if err != nil {
-		return err
-	}
-	return nil
+		c.Subscriptions = keepSubscriptions
+		return nil
+	})
 }
 
 func (p *PIN) IsValid(s string) error {
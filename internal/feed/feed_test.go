@@ -2,10 +2,23 @@ package feed
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
+func TestMain(m *testing.M) {
+	if err := os.MkdirAll("tests", 0700); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll("tests")
+	os.Exit(code)
+}
+
 func TestGetFeedItemData(t *testing.T) {
 	t.Cleanup(func() {
 		os.RemoveAll("tests/feed1")
@@ -22,7 +35,7 @@ func TestGetFeedItemData(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pf, err := f.Public()
+	pf, err := f.Public(Scopes{ScopeAdmin})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -33,6 +46,21 @@ func TestGetFeedItemData(t *testing.T) {
 	}
 }
 
+func TestAddItemUnknownContentTypeWithoutExtension(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll("tests/feed1")
+	})
+	f, err := NewFeed("tests/feed1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.AddItem("foo/bar", "", bytes.NewReader([]byte("test")))
+	if !errors.Is(err, FeedErrorInvalidContentType) {
+		t.Fatalf("Expected invalid content type error, got %v", err)
+	}
+}
+
 func TestPathTraversalGet(t *testing.T) {
 	t.Cleanup(func() {
 		os.RemoveAll("tests/feed1")
@@ -115,7 +143,7 @@ func TestPublicItem(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	pf, err := f.Public()
+	pf, err := f.Public(Scopes{ScopeAdmin})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -127,3 +155,249 @@ func TestPublicItem(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestScopesForSecret(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll("tests/feed1")
+	})
+	f, err := NewFeed("tests/feed1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := f.Config.AddToken("dropbox", Scopes{ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.HasScope(token.Token, ScopeWrite); err != nil {
+		t.Errorf("Expected write scope, got %s", err.Error())
+	}
+
+	if err = f.HasScope(token.Token, ScopeRead); !errors.Is(err, FeedErrorInsufficientScope) {
+		t.Errorf("Expected insufficient scope error, got %v", err)
+	}
+
+	if err = f.HasScope(f.Config.Secret, ScopeDelete); err != nil {
+		t.Errorf("Expected feed secret to grant all scopes, got %s", err.Error())
+	}
+
+	if _, err = f.ScopesForSecret("1234"); !errors.Is(err, FeedConfigErrorPinIncorrect) {
+		t.Errorf("Expected incorrect PIN error, got %v", err)
+	}
+
+	if _, err = f.Config.AddToken("bad", Scopes{"foo"}); !errors.Is(err, FeedErrorInvalidScope) {
+		t.Errorf("Expected invalid scope error, got %v", err)
+	}
+
+	if err = f.Config.DeleteToken(token.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = f.ScopesForSecret(token.Token); !errors.Is(err, FeedErrorIncorrectSecret) {
+		t.Errorf("Expected revoked token to be rejected, got %v", err)
+	}
+}
+
+func TestCreateFeedWithRetention(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll("tests/retention")
+	})
+
+	fm := NewFeedManager("tests", nil)
+	f, err := fm.CreateFeed("retention", FeedOptions{
+		Description: "Short lived",
+		Retention:   Duration(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = fm.CreateFeed("retention", FeedOptions{}); !errors.Is(err, FeedErrorAlreadyExists) {
+		t.Errorf("Expect %v but got %v", FeedErrorAlreadyExists, err)
+	}
+
+	if f.Config.Description != "Short lived" || f.Config.Retention != Duration(time.Hour) {
+		t.Errorf("Unexpected feed configuration %+v", f.Config)
+	}
+
+	if err = f.AddItem("text/plain", "", bytes.NewReader([]byte("test"))); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := f.ExpireItems(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("Expect no expired items but got %d", count)
+	}
+
+	count, err = f.ExpireItems(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("Expect 1 expired item but got %d", count)
+	}
+}
+
+func TestCreateFeedWithUnsafeName(t *testing.T) {
+	fm := NewFeedManager("tests", nil)
+
+	for _, name := range []string{"", ".", "..", "../feed1", "a/b", "a\\b", "Users.json"} {
+		if _, err := fm.CreateFeed(name, FeedOptions{}); !errors.Is(err, FeedErrorInvalidName) {
+			t.Errorf("Expect %v for %q but got %v", FeedErrorInvalidName, name, err)
+		}
+		if _, err := fm.GetFeed(name); !errors.Is(err, FeedErrorInvalidName) {
+			t.Errorf("Expect %v for %q but got %v", FeedErrorInvalidName, name, err)
+		}
+	}
+}
+
+func TestRotateSecret(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll("tests/rotate")
+	})
+
+	f, err := NewFeed("tests/rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := f.Config.Secret
+
+	if err = f.Config.RotateSecret(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.IsSecretValid(previous); !errors.Is(err, FeedErrorIncorrectSecret) {
+		t.Errorf("Expect %v but got %v", FeedErrorIncorrectSecret, err)
+	}
+
+	f, err = GetFeed("tests/rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Config.Secret == previous {
+		t.Errorf("Secret has not been saved")
+	}
+}
+
+func TestConcurrentConfigUpdates(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll("tests/concurrent")
+	})
+
+	if _, err := NewFeed("tests/concurrent"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every change is made on a copy of the feed loaded before any of them,
+	// as done by concurrent API requests
+	const count = 20
+	feeds := make([]*Feed, count)
+	for i := range feeds {
+		f, err := GetFeed("tests/concurrent")
+		if err != nil {
+			t.Fatal(err)
+		}
+		feeds[i] = f
+	}
+
+	wg := sync.WaitGroup{}
+	for i, f := range feeds {
+		wg.Add(1)
+		go func(i int, f *Feed) {
+			defer wg.Done()
+			if _, err := f.Config.AddToken(fmt.Sprintf("token%d", i), Scopes{ScopeRead}); err != nil {
+				t.Error(err)
+			}
+		}(i, f)
+	}
+	wg.Wait()
+
+	f, err := GetFeed("tests/concurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Config.Tokens) != count {
+		t.Errorf("Expect %d tokens but got %d", count, len(f.Config.Tokens))
+	}
+	if _, err = os.Stat("tests/concurrent/" + configTempFile); !os.IsNotExist(err) {
+		t.Errorf("Temporary configuration file left behind")
+	}
+}
+
+func TestConcurrentRenameFeed(t *testing.T) {
+	const count = 10
+	t.Cleanup(func() {
+		for i := 0; i < count; i++ {
+			os.RemoveAll(fmt.Sprintf("tests/source%d", i))
+		}
+		os.RemoveAll("tests/target")
+		os.RemoveAll("tests/empty")
+		os.Remove("tests/" + aliasesFile)
+	})
+
+	fm := NewFeedManager("tests", nil)
+	for i := 0; i < count; i++ {
+		if _, err := fm.CreateFeed(fmt.Sprintf("source%d", i), FeedOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only one of the renames and the creation racing for the same name wins,
+	// the last goroutine creates the feed
+	results := make([]error, count+1)
+	wg := sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i == count {
+				_, results[i] = fm.CreateFeed("target", FeedOptions{})
+			} else {
+				_, results[i] = fm.RenameFeed(fmt.Sprintf("source%d", i), "target")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range results {
+		if err == nil {
+			if winner != -1 {
+				t.Fatalf("Both %d and %d succeeded", winner, i)
+			}
+			winner = i
+		} else if !errors.Is(err, FeedErrorAlreadyExists) {
+			t.Errorf("Expect %v but got %v", FeedErrorAlreadyExists, err)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("No rename or creation succeeded")
+	}
+
+	// Losing feeds are left in place
+	for i := 0; i < count; i++ {
+		_, err := os.Stat(fmt.Sprintf("tests/source%d", i))
+		if i == winner && err == nil {
+			t.Errorf("Renamed feed source%d still exists", i)
+		}
+		if i != winner && err != nil {
+			t.Errorf("Feed source%d is gone: %v", i, err)
+		}
+	}
+
+	// An empty directory isn't replaced either
+	if err := os.Mkdir("tests/empty", 0700); err != nil {
+		t.Fatal(err)
+	}
+	source := "source0"
+	if winner == 0 {
+		source = "source1"
+	}
+	if _, err := fm.RenameFeed(source, "empty"); !errors.Is(err, FeedErrorAlreadyExists) {
+		t.Errorf("Expect %v but got %v", FeedErrorAlreadyExists, err)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
 )
 
 // FeedManager is the main interface tu feeds and contains the path to ybFeed
@@ -12,14 +16,23 @@ import (
 type FeedManager struct {
 	NotificationSettings *NotificationSettings
 
+	// AliasLifetime is the time during which the previous name of a renamed
+	// feed redirects to the new name
+	AliasLifetime time.Duration
+
 	path             string
 	websocketManager *WebSocketManager
+	aliasMutex       sync.Mutex
+
+	// feedMutex is held while feed directories are created or renamed
+	feedMutex sync.Mutex
 }
 
 // NewFeedManager returns a FeedManager initialized with the mandatory
 // path and websocket manager w.
 func NewFeedManager(path string, w *WebSocketManager) *FeedManager {
 	result := &FeedManager{
+		AliasLifetime:    DefaultAliasLifetime,
 		path:             path,
 		websocketManager: w,
 	}
@@ -30,6 +43,11 @@ func NewFeedManager(path string, w *WebSocketManager) *FeedManager {
 // Be careful when using GetFeed that the result isn't returned to the browser
 // directly. It should ony be used for internal methods
 func (m *FeedManager) GetFeed(feedName string) (*Feed, error) {
+	feedName, err := m.lookupFeedName(feedName)
+	if err != nil {
+		return nil, err
+	}
+
 	feedPath := path.Join(m.path, feedName)
 
 	result, err := GetFeed(feedPath)
@@ -43,6 +61,77 @@ func (m *FeedManager) GetFeed(feedName string) (*Feed, error) {
 	return result, nil
 }
 
+// lookupFeedName returns the name of the directory of feed feedName in data
+// folder. Names are normalized like in CreateFeed, and an error wrapping
+// FeedErrorInvalidName is returned for invalid names. Feeds created before
+// names were validated are still found by their raw name, as long as it can't
+// point outside of data folder. They can be renamed to a valid name.
+func (m *FeedManager) lookupFeedName(feedName string) (string, error) {
+	normalized, err := NormalizeFeedName(feedName)
+	if err == nil {
+		if normalized == feedName {
+			return normalized, nil
+		}
+		if _, statErr := os.Stat(path.Join(m.path, normalized)); statErr == nil {
+			return normalized, nil
+		}
+	}
+
+	if pathErr := checkFeedPath(feedName); pathErr != nil {
+		return "", pathErr
+	}
+
+	// Invalid names are only accepted for existing legacy feeds
+	if err != nil {
+		if stat, statErr := os.Stat(path.Join(m.path, feedName)); statErr != nil || !stat.IsDir() {
+			return "", err
+		}
+	}
+
+	return feedName, nil
+}
+
+// FeedOptions are the settings of a new feed
+type FeedOptions struct {
+	Description string
+	Retention   Duration
+	Owner       string
+}
+
+// CreateFeed creates the feed feedName configured with options. feedName is
+// validated and normalized with NormalizeFeedName.
+func (m *FeedManager) CreateFeed(feedName string, options FeedOptions) (*Feed, error) {
+	feedName, err := NormalizeFeedName(feedName)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Retention < 0 {
+		return nil, fmt.Errorf("%w: %s", FeedConfigErrorInvalidRetention, time.Duration(options.Retention))
+	}
+
+	m.feedMutex.Lock()
+	f, err := NewFeed(path.Join(m.path, feedName))
+	m.feedMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// The new feed replaces a previous alias with the same name
+	if err = m.removeAlias(feedName); err != nil {
+		fL.Logger.Error("Unable to remove alias", slog.String("feed", feedName), slog.String("error", err.Error()))
+	}
+
+	f.Config.Description = options.Description
+	f.Config.Retention = options.Retention
+	f.Config.Owner = options.Owner
+	if err = f.Config.Write(); err != nil {
+		return nil, err
+	}
+
+	return m.GetFeed(feedName)
+}
+
 // GetFeedWithAuth returns the Feed feedName if the secret is valid,
 // otherwise it returns an error. GetFeedWithAuth should always be user
 // when fetching a Feed for end user consumption
@@ -62,23 +151,217 @@ func (m *FeedManager) GetFeedWithAuth(feedName string, secret string) (*Feed, er
 	return result, nil
 }
 
-func (m *FeedManager) DumpSecrets() {
+// GetFeedWithScope returns the Feed feedName if the secret or the
+// authenticated user grants scope on the feed, otherwise it returns an error.
+// user is empty for anonymous requests.
+func (m *FeedManager) GetFeedWithScope(feedName string, secret string, user string, scope Scope) (*Feed, error) {
+	result, err := m.GetFeed(feedName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = result.Authorize(secret, user, scope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FeedSecret associates a feed name with its secret, it is used to recover
+// lost secrets by server administrators
+type FeedSecret struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// FeedNames returns the names of all feeds in data folder
+func (m *FeedManager) FeedNames() ([]string, error) {
 	d, err := os.ReadDir(m.path)
 	if err != nil {
-		// TODO: log error
-		return
+		return nil, err
 	}
+
+	result := []string{}
 	for _, entry := range d {
 		if !entry.IsDir() {
 			continue
 		}
-		feedPath := path.Join(m.path, entry.Name())
+		result = append(result, entry.Name())
+	}
+	return result, nil
+}
+
+// UserFeed is a feed owned by a user or shared with them
+type UserFeed struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// FeedsForUser returns the feeds owned by user or shared with them
+func (m *FeedManager) FeedsForUser(user string) ([]UserFeed, error) {
+	names, err := m.FeedNames()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []UserFeed{}
+	if user == "" {
+		return result, nil
+	}
+	for _, name := range names {
+		f, err := m.GetFeed(name)
+		if err != nil {
+			fL.Logger.Error("Unable to read feed", slog.String("feed", name), slog.String("error", err.Error()))
+			continue
+		}
+		if role := f.RoleForUser(user); role != "" {
+			result = append(result, UserFeed{Name: f.Name(), Role: role})
+		}
+	}
+	return result, nil
+}
+
+// RemoveUser removes user from the owner and members of every feed
+func (m *FeedManager) RemoveUser(user string) error {
+	names, err := m.FeedNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		f, err := m.GetFeed(name)
+		if err != nil {
+			fL.Logger.Error("Unable to read feed", slog.String("feed", name), slog.String("error", err.Error()))
+			continue
+		}
+		if f.RoleForUser(user) == "" {
+			continue
+		}
+		err = f.Config.update(func(c *FeedConfig) error {
+			if c.Owner == user {
+				c.Owner = ""
+			}
+			members := []Member{}
+			for _, member := range c.Members {
+				if member.User != user {
+					members = append(members, member)
+				}
+			}
+			c.Members = members
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Secrets returns the secret of every feed
+func (m *FeedManager) Secrets() ([]FeedSecret, error) {
+	names, err := m.FeedNames()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []FeedSecret{}
+	for _, name := range names {
+		f, err := m.GetFeed(name)
+		if err != nil {
+			fL.Logger.Error("Unable to read feed", slog.String("feed", name), slog.String("error", err.Error()))
+			continue
+		}
+		result = append(result, FeedSecret{
+			Name:   f.Name(),
+			Secret: f.Config.Secret,
+		})
+	}
+	return result, nil
+}
+
+// ExpireItems removes items older than their feed retention in every feed
+func (m *FeedManager) ExpireItems() {
+	names, err := m.FeedNames()
+	if err != nil {
+		fL.Logger.Error("Unable to list feeds", slog.String("error", err.Error()))
+		return
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		f, err := m.GetFeed(name)
+		if err != nil {
+			fL.Logger.Error("Unable to read feed", slog.String("feed", name), slog.String("error", err.Error()))
+			continue
+		}
+		count, err := f.ExpireItems(now)
+		if err != nil {
+			fL.Logger.Error("Unable to expire items", slog.String("feed", name), slog.String("error", err.Error()))
+		}
+		if count > 0 {
+			fL.Logger.Info("Expired items", slog.String("feed", name), slog.Int("count", count))
+		}
+	}
+}
+
+// RunRetention calls ExpireItems every interval, it never returns
+func (m *FeedManager) RunRetention(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		m.ExpireItems()
+	}
+}
+
+// DeleteFeed removes feed feedName with all its items, configuration and
+// aliases. Connected websockets are closed with CloseFeedDeleted.
+func (m *FeedManager) DeleteFeed(feedName string) error {
+	f, err := m.GetFeed(feedName)
+	if err != nil {
+		return err
+	}
+	feedName = f.Name()
+
+	if err = os.RemoveAll(f.Path); err != nil {
+		return err
+	}
+
+	if err = m.removeAliasesTo(feedName); err != nil {
+		fL.Logger.Error("Unable to remove aliases", slog.String("feed", feedName), slog.String("error", err.Error()))
+	}
+
+	if m.websocketManager != nil {
+		m.websocketManager.CloseFeed(feedName, CloseFeedDeleted, "feed deleted")
+	}
 
-		result, err := GetFeed(feedPath)
+	fL.Logger.Info("Deleted feed", slog.String("feed", feedName))
+
+	return nil
+}
+
+// Stats returns usage statistics of every feed
+func (m *FeedManager) Stats() ([]FeedStats, error) {
+	names, err := m.FeedNames()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []FeedStats{}
+	for _, name := range names {
+		f, err := m.GetFeed(name)
+		if err != nil {
+			fL.Logger.Error("Unable to read feed", slog.String("feed", name), slog.String("error", err.Error()))
+			continue
+		}
+		stats, err := f.Stats()
 		if err != nil {
-			// TODO Log error
-			return
+			fL.Logger.Error("Unable to get feed statistics", slog.String("feed", name), slog.String("error", err.Error()))
+			continue
 		}
-		fmt.Printf("Feed %s: %s\n", result.Name(), result.Config.Secret)
+		result = append(result, *stats)
 	}
+	return result, nil
 }
@@ -0,0 +1,150 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role is the level of access of a feed member
+type Role string
+
+// Available roles. The owner of a feed always has RoleOwner.
+const (
+	RoleViewer      Role = "viewer"
+	RoleContributor Role = "contributor"
+	RoleAdmin       Role = "admin"
+	RoleOwner       Role = "owner"
+)
+
+// Errors related to feed members
+var (
+	FeedErrorInvalidRole     = errors.New("invalid role")
+	FeedErrorMemberNotFound  = errors.New("member not found")
+	FeedErrorMemberIsOwner   = errors.New("member is the feed owner")
+	FeedErrorInvalidMemberID = errors.New("invalid member")
+	FeedErrorAlreadyOwned    = errors.New("feed already has an owner")
+)
+
+// Scopes returns the scopes granted by role
+func (r Role) Scopes() Scopes {
+	switch r {
+	case RoleViewer:
+		return Scopes{ScopeRead}
+	case RoleContributor:
+		return Scopes{ScopeRead, ScopeWrite, ScopeDelete}
+	case RoleAdmin, RoleOwner:
+		return Scopes{ScopeAdmin}
+	}
+	return nil
+}
+
+// ParseRole returns the Role named s, or an error if s isn't a role that can
+// be given to a member
+func ParseRole(s string) (Role, error) {
+	switch Role(s) {
+	case RoleViewer, RoleContributor, RoleAdmin:
+		return Role(s), nil
+	}
+	return "", fmt.Errorf("%w: %s", FeedErrorInvalidRole, s)
+}
+
+// Member is a user the feed is shared with
+type Member struct {
+	User string `json:"user"`
+	Role Role   `json:"role"`
+}
+
+// TransferOwner makes user the owner of the feed on behalf of caller, and
+// saves feed configuration. An unowned feed can be claimed by anyone, an owned
+// feed can only be transferred by its current owner.
+func (config *FeedConfig) TransferOwner(caller string, user string) error {
+	if user == "" {
+		return FeedErrorInvalidMemberID
+	}
+
+	return config.update(func(c *FeedConfig) error {
+		if c.Owner != "" && c.Owner != caller {
+			return fmt.Errorf("%w: %s", FeedErrorAlreadyOwned, c.Owner)
+		}
+
+		// The owner can't also be a member
+		members := []Member{}
+		for _, m := range c.Members {
+			if m.User != user {
+				members = append(members, m)
+			}
+		}
+		c.Members = members
+		c.Owner = user
+		return nil
+	})
+}
+
+// SetMember shares the feed with user, or changes their role if they are
+// already a member, and saves feed configuration
+func (config *FeedConfig) SetMember(user string, role Role) error {
+	if user == "" {
+		return FeedErrorInvalidMemberID
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+
+	return config.update(func(c *FeedConfig) error {
+		if user == c.Owner {
+			return fmt.Errorf("%w: %s", FeedErrorMemberIsOwner, user)
+		}
+
+		found := false
+		for i, m := range c.Members {
+			if m.User == user {
+				c.Members[i].Role = role
+				found = true
+			}
+		}
+		if !found {
+			c.Members = append(c.Members, Member{User: user, Role: role})
+		}
+		return nil
+	})
+}
+
+// RemoveMember stops sharing the feed with user and saves feed configuration
+func (config *FeedConfig) RemoveMember(user string) error {
+	return config.update(func(c *FeedConfig) error {
+		keepMembers := []Member{}
+		found := false
+
+		for _, m := range c.Members {
+			if m.User == user {
+				found = true
+				continue
+			}
+			keepMembers = append(keepMembers, m)
+		}
+
+		if !found {
+			return fmt.Errorf("%w: %s", FeedErrorMemberNotFound, user)
+		}
+
+		c.Members = keepMembers
+		return nil
+	})
+}
+
+// RoleForUser returns the role of user on the feed, or an empty Role if the
+// feed isn't shared with user
+func (feed *Feed) RoleForUser(user string) Role {
+	if user == "" {
+		return ""
+	}
+	if feed.Config.Owner == user {
+		return RoleOwner
+	}
+	for _, m := range feed.Config.Members {
+		if m.User == user {
+			return m.Role
+		}
+	}
+	return ""
+}
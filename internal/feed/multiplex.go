@@ -0,0 +1,187 @@
+package feed
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ws "github.com/gorilla/websocket"
+	"golang.org/x/exp/slog"
+)
+
+// Authorizer returns feed feedName and the scopes granted to the client
+// with secret. Errors should be a *CommandError telling the client why
+// access is denied.
+type Authorizer func(feedName string, secret string) (*Feed, Scopes, error)
+
+// SubscribeResult is the result of the subscribe command, Seq is the
+// sequence of the last notification of the feed
+type SubscribeResult struct {
+	Feed   string `json:"feed"`
+	Seq    uint64 `json:"seq"`
+	Scopes Scopes `json:"scopes"`
+}
+
+// feedSubscription is a feed a websocket connected to several feeds
+// subscribed to
+type feedSubscription struct {
+	secret string
+	fs     *FeedSockets
+	c      *subscriber
+}
+
+// RunSocket promotes an HTTP connection to a websocket receiving
+// notifications of several feeds. The client subscribes to each feed with
+// its own secret, checked with authorize, and notifications are tagged with
+// the feed name. This function is blocking and typically runs from a http
+// handler.
+func (m *WebSocketManager) RunSocket(authorize Authorizer, w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		wsL.Logger.Error("Unable to upgrade WebSocket", slog.String("error", err.Error()))
+		return
+	}
+
+	conn := m.newSubscriber()
+	conn.identify(r)
+	subscriptions := []*feedSubscription{}
+
+	// Cleanup
+	defer func() {
+		for _, s := range subscriptions {
+			m.unregister(s.fs, s.c)
+		}
+		conn.stop(0, "")
+	}()
+
+	m.serve(c, conn, func() string { return "" }, func(data []byte) {
+		var cmd Command
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			m.reply(conn, commandFailed(cmd, http.StatusBadRequest, "invalid command"))
+			return
+		}
+
+		i := m.subscription(subscriptions, cmd.Feed)
+
+		switch cmd.Command {
+		case CommandSubscribe:
+			subscriptions = m.activeSubscriptions(subscriptions)
+			if s := m.subscribe(conn, subscriptions, cmd, authorize); s != nil {
+				subscriptions = append(subscriptions, s)
+			}
+
+		case CommandUnsubscribe:
+			if i < 0 {
+				m.reply(conn, commandFailed(cmd, http.StatusNotFound, "not subscribed"))
+				return
+			}
+			m.unregister(subscriptions[i].fs, subscriptions[i].c)
+			subscriptions = append(subscriptions[:i], subscriptions[i+1:]...)
+			m.reply(conn, CommandResponse{ID: cmd.ID, Command: cmd.Command, Result: struct{}{}})
+
+		default:
+			if i < 0 {
+				m.reply(conn, commandFailed(cmd, http.StatusNotFound, "not subscribed"))
+				return
+			}
+			s := subscriptions[i]
+			m.reply(conn, m.runCommand(func() (*Feed, Scopes, error) {
+				return authorize(m.feedName(s.fs), s.secret)
+			}, data))
+		}
+	})
+}
+
+// subscription returns the index of the subscription to feed feedName, or
+// -1 if the websocket didn't subscribe to it or the feed was closed
+func (m *WebSocketManager) subscription(subscriptions []*feedSubscription, feedName string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, s := range subscriptions {
+		if s.fs.feedName == feedName && m.feedSockets[feedName] == s.fs {
+			return i
+		}
+	}
+	return -1
+}
+
+// activeSubscriptions returns subscriptions without the feeds that were
+// closed
+func (m *WebSocketManager) activeSubscriptions(subscriptions []*feedSubscription) []*feedSubscription {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := subscriptions[:0]
+	for _, s := range subscriptions {
+		if m.feedSockets[s.fs.feedName] == s.fs {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// subscribe runs the subscribe command cmd of websocket conn, and returns
+// the new subscription or nil if it failed
+func (m *WebSocketManager) subscribe(conn *subscriber, subscriptions []*feedSubscription, cmd Command, authorize Authorizer) *feedSubscription {
+	f, scopes, err := authorize(cmd.Feed, cmd.Secret)
+	switch {
+	case err != nil:
+	case !scopes.Has(ScopeRead):
+		err = &CommandError{Code: http.StatusForbidden, Message: "read scope required"}
+	// Feeds may be subscribed to with an alias
+	case m.subscription(subscriptions, f.Name()) >= 0:
+		err = &CommandError{Code: http.StatusConflict, Message: "already subscribed"}
+	case len(subscriptions) >= m.maxSubscriptions():
+		err = &CommandError{Code: http.StatusTooManyRequests, Message: "too many subscriptions"}
+	}
+	if err != nil {
+		cerr := asCommandError(err)
+		m.reply(conn, commandFailed(cmd, cerr.Code, cerr.Message))
+		return nil
+	}
+
+	s := &feedSubscription{
+		secret: cmd.Secret,
+		c:      &subscriber{outbox: conn.outbox, tagged: true},
+	}
+
+	// The response is queued before missed notifications, and no
+	// notification can be sent in between
+	m.mutex.Lock()
+	s.fs = m.registerLocked(f.Name(), s.c)
+	sent := conn.sendJSON(CommandResponse{
+		ID:      cmd.ID,
+		Command: cmd.Command,
+		Result: SubscribeResult{
+			Feed:   f.Name(),
+			Seq:    m.eventLog(f.Name()).seq,
+			Scopes: scopes,
+		},
+	})
+	slow := !sent
+	if sent && cmd.Since != nil {
+		slow = m.resumeLocked(s.fs, s.c, *cmd.Since)
+	}
+	m.mutex.Unlock()
+
+	m.join(f.Name(), s.c)
+
+	wsL.Logger.Debug("Websocket subscribed",
+		slog.String("feedName", f.Name()),
+		slog.Bool("slow", slow))
+
+	if slow {
+		m.drop(s.fs, s.c)
+	}
+
+	return s
+}
+
+// reply queues response on websocket conn, which is disconnected if it is
+// too slow
+func (m *WebSocketManager) reply(conn *subscriber, response CommandResponse) {
+	if !conn.sendJSON(response) {
+		wsL.Logger.Warn("Disconnecting slow websocket")
+		conn.stop(ws.CloseTryAgainLater, "too slow")
+	}
+}
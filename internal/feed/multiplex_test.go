@@ -0,0 +1,177 @@
+package feed
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// readTagged reads the next notification on c, skipping command responses
+func readTagged(t *testing.T, c *ws.Conn) FeedNotification {
+	t.Helper()
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var n FeedNotification
+		if err := c.ReadJSON(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n.Action != "" {
+			return n
+		}
+	}
+}
+
+func TestWebSocketMultipleFeeds(t *testing.T) {
+	m, a, _ := newWebSocketServer(t)
+	b, err := m.FeedManager.CreateFeed("other", FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.RunSocket(authorizeSecret(m.FeedManager), w, r)
+	}))
+	defer server.Close()
+
+	c := dialWebSocket(t, server)
+	defer c.Close()
+
+	// Subscribe to both feeds with their own secret
+	tests := []struct {
+		command Command
+		code    int
+	}{
+		{Command{ID: "1", Command: CommandSubscribe, Feed: a.Name(), Secret: a.Config.Secret}, 0},
+		{Command{ID: "2", Command: CommandSubscribe, Feed: b.Name(), Secret: a.Config.Secret}, http.StatusUnauthorized},
+		{Command{ID: "3", Command: CommandSubscribe, Feed: "unknown", Secret: a.Config.Secret}, http.StatusNotFound},
+		{Command{ID: "4", Command: CommandSubscribe, Feed: b.Name(), Secret: b.Config.Secret}, 0},
+		{Command{ID: "5", Command: CommandSubscribe, Feed: a.Name(), Secret: a.Config.Secret}, http.StatusConflict},
+		{Command{ID: "6", Command: CommandItems, Feed: "unknown"}, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		r := sendCommand(t, c, test.command)
+		switch {
+		case test.code == 0 && r.Error != nil:
+			t.Fatalf("Unexpected error for %s: %v", test.command.ID, r.Error)
+		case test.code != 0 && (r.Error == nil || r.Error.Code != test.code):
+			t.Fatalf("Expect error %d for %s but got %v", test.code, test.command.ID, r.Error)
+		}
+		if test.command.Command == CommandSubscribe && test.code == 0 {
+			var result SubscribeResult
+			if err := json.Unmarshal(r.Result.(json.RawMessage), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Feed != test.command.Feed || !result.Scopes.Has(ScopeAdmin) {
+				t.Fatalf("Unexpected subscribe result %+v", result)
+			}
+		}
+	}
+
+	// Notifications are tagged with their feed
+	if err := a.AddItem("text/plain", "", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if n := readTagged(t, c); n.Feed != a.Name() || n.Action != "add" || n.Seq != 1 {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+	// Notifications of commands are received before their response
+	if err := c.WriteJSON(Command{ID: "7", Command: CommandAdd, Feed: b.Name(), Text: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := readTagged(t, c); n.Feed != b.Name() || n.Action != "add" || n.Seq != 1 {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+	var r CommandResponse
+	if err := c.ReadJSON(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "7" || r.Error != nil {
+		t.Fatalf("Unexpected response %+v", r)
+	}
+
+	// Unsubscribed feeds are not notified anymore
+	r = sendCommand(t, c, Command{ID: "8", Command: CommandUnsubscribe, Feed: a.Name()})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+	if err := a.AddItem("text/plain", "", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Empty(); err != nil {
+		t.Fatal(err)
+	}
+	if n := readTagged(t, c); n.Feed != b.Name() || n.Action != "empty" {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+
+	// Subscribing again resumes from a sequence
+	since := uint64(1)
+	r = sendCommand(t, c, Command{ID: "9", Command: CommandSubscribe, Feed: a.Name(), Secret: a.Config.Secret, Since: &since})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+	if n := readTagged(t, c); n.Feed != a.Name() || n.Action != "add" || n.Seq != 2 {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+
+	// Deleted feeds are closed, the websocket stays connected to others
+	if err := m.FeedManager.DeleteFeed(a.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if n := readTagged(t, c); n.Feed != a.Name() || n.Action != ActionClosed || n.Code != CloseFeedDeleted {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+	r = sendCommand(t, c, Command{ID: "10", Command: CommandItems, Feed: a.Name()})
+	if r.Error == nil || r.Error.Code != http.StatusNotFound {
+		t.Fatalf("Expect not found error but got %v", r.Error)
+	}
+	if err := b.AddItem("text/plain", "", strings.NewReader("b")); err != nil {
+		t.Fatal(err)
+	}
+	if n := readTagged(t, c); n.Feed != b.Name() || n.Action != "add" {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+}
+
+func TestWebSocketMaxSubscriptions(t *testing.T) {
+	m, a, _ := newWebSocketServer(t)
+	m.MaxSubscriptions = 1
+	b, err := m.FeedManager.CreateFeed("other", FeedOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.RunSocket(authorizeSecret(m.FeedManager), w, r)
+	}))
+	defer server.Close()
+
+	c := dialWebSocket(t, server)
+	defer c.Close()
+
+	r := sendCommand(t, c, Command{ID: "1", Command: CommandSubscribe, Feed: a.Name(), Secret: a.Config.Secret})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+	r = sendCommand(t, c, Command{ID: "2", Command: CommandSubscribe, Feed: b.Name(), Secret: b.Config.Secret})
+	if r.Error == nil || r.Error.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expect error %d but got %v", http.StatusTooManyRequests, r.Error)
+	}
+
+	// Closed feeds don't count
+	if err = m.FeedManager.DeleteFeed(a.Name()); err != nil {
+		t.Fatal(err)
+	}
+	if n := readTagged(t, c); n.Action != ActionClosed {
+		t.Fatalf("Unexpected notification %+v", n)
+	}
+	r = sendCommand(t, c, Command{ID: "3", Command: CommandSubscribe, Feed: b.Name(), Secret: b.Config.Secret})
+	if r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+}
@@ -0,0 +1,146 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxFeedNameLength is the maximum number of characters in a feed name
+const MaxFeedNameLength = 64
+
+// FeedErrorInvalidName is returned when a feed name is not allowed
+var FeedErrorInvalidName = errors.New("invalid feed name")
+
+// reservedFeedNames can't be used as feed names, in addition to
+// reservedFileNames, because they are paths used by ybFeed. They are compared
+// case insensitively.
+var reservedFeedNames = []string{
+	"api",
+	"ws",
+	"auth",
+	"admin",
+	"assets",
+}
+
+// reservedFileNames are files in data directory that can't be used as feed
+// names. They are compared case insensitively.
+var reservedFileNames = []string{
+	"config.json",
+	"users.json",
+	"aliases.json",
+}
+
+// checkFeedPath returns an error wrapping FeedErrorInvalidName if name can't
+// be safely used as a directory of data folder, because it would point
+// outside of it or to a file used by ybFeed
+func checkFeedPath(name string) error {
+	switch name {
+	case "":
+		return fmt.Errorf("%w: name is empty", FeedErrorInvalidName)
+	case ".", "..":
+		return fmt.Errorf("%w: %s", FeedErrorInvalidName, name)
+	}
+
+	if strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("%w: name can't contain path separators", FeedErrorInvalidName)
+	}
+
+	for _, r := range reservedFileNames {
+		if strings.EqualFold(name, r) {
+			return fmt.Errorf("%w: %s is reserved", FeedErrorInvalidName, name)
+		}
+	}
+
+	return nil
+}
+
+// allowedFeedNamePunctuation contains the characters allowed in a feed name
+// in addition to letters and digits
+const allowedFeedNamePunctuation = " -_#"
+
+// japaneseScripts can be mixed in a single name
+var japaneseScripts = map[string]bool{"Han": true, "Hiragana": true, "Katakana": true}
+
+// NormalizeFeedName returns the NFC normalized form of name, or an error
+// wrapping FeedErrorInvalidName if name is not allowed.
+//
+// Feed names are made of letters, digits, spaces, "-", "_" and "#". They
+// can't start or end with a space, letters of different scripts can't be
+// mixed, and compatibility characters like full width letters are rejected
+// so names can't be confused with look-alikes.
+func NormalizeFeedName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("%w: not valid UTF-8", FeedErrorInvalidName)
+	}
+
+	name = norm.NFC.String(name)
+
+	length := utf8.RuneCountInString(name)
+	if length == 0 {
+		return "", fmt.Errorf("%w: name is empty", FeedErrorInvalidName)
+	}
+	if length > MaxFeedNameLength {
+		return "", fmt.Errorf("%w: name is longer than %d characters", FeedErrorInvalidName, MaxFeedNameLength)
+	}
+
+	if err := checkFeedPath(name); err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(name) != name {
+		return "", fmt.Errorf("%w: name can't start or end with a space", FeedErrorInvalidName)
+	}
+
+	for _, r := range reservedFeedNames {
+		if strings.EqualFold(name, r) {
+			return "", fmt.Errorf("%w: %s is reserved", FeedErrorInvalidName, name)
+		}
+	}
+
+	if norm.NFKC.String(name) != name {
+		return "", fmt.Errorf("%w: %s contains compatibility characters", FeedErrorInvalidName, name)
+	}
+
+	scripts := map[string]bool{}
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			if s := scriptOf(r); s != "" {
+				scripts[s] = true
+			}
+		case unicode.IsDigit(r), unicode.Is(unicode.Mn, r):
+		case strings.ContainsRune(allowedFeedNamePunctuation, r):
+		default:
+			return "", fmt.Errorf("%w: character %q is not allowed", FeedErrorInvalidName, r)
+		}
+	}
+
+	if len(scripts) > 1 {
+		for s := range scripts {
+			if !japaneseScripts[s] {
+				return "", fmt.Errorf("%w: %s mixes letters from different scripts", FeedErrorInvalidName, name)
+			}
+		}
+	}
+
+	return name, nil
+}
+
+// scriptOf returns the name of the unicode script of r, or an empty string
+// for letters shared by several scripts
+func scriptOf(r rune) string {
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeFeedName(t *testing.T) {
+	valid := map[string]string{
+		"test":                                 "test",
+		"6ff1146b6830 #86b8f59f550189a8f91f":   "6ff1146b6830 #86b8f59f550189a8f91f",
+		"my_feed-2":                            "my_feed-2",
+		"café":                                "café",
+		"日本語のフィード":                             "日本語のフィード",
+		"Привет":                               "Привет",
+		strings.Repeat("a", MaxFeedNameLength): strings.Repeat("a", MaxFeedNameLength),
+	}
+	for name, expected := range valid {
+		result, err := NormalizeFeedName(name)
+		if err != nil {
+			t.Errorf("Expect %q to be valid but got %v", name, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("Expect %q to be normalized to %q but got %q", name, expected, result)
+		}
+	}
+
+	invalid := []string{
+		"",
+		" test",
+		"test ",
+		"config.json",
+		"Config.JSON",
+		"api",
+		"..",
+		"a/b",
+		"a.b",
+		"a\x00b",
+		"a\nb",
+		"pаypal",
+		"ｔｅｓｔ",
+		strings.Repeat("a", MaxFeedNameLength+1),
+		"\xff",
+	}
+	for _, name := range invalid {
+		if _, err := NormalizeFeedName(name); !errors.Is(err, FeedErrorInvalidName) {
+			t.Errorf("Expect %q to be invalid but got %v", name, err)
+		}
+	}
+}
+
+func TestLegacyFeedName(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll("tests/legacy.feed")
+		os.RemoveAll("tests/legacy")
+	})
+
+	// Feeds created before names were validated
+	if _, err := NewFeed("tests/legacy.feed"); err != nil {
+		t.Fatal(err)
+	}
+
+	fm := NewFeedManager("tests", nil)
+
+	if _, err := fm.CreateFeed("other.feed", FeedOptions{}); !errors.Is(err, FeedErrorInvalidName) {
+		t.Errorf("Expect %v but got %v", FeedErrorInvalidName, err)
+	}
+
+	f, err := fm.GetFeed("legacy.feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() != "legacy.feed" {
+		t.Errorf("Expect feed legacy.feed but got %s", f.Name())
+	}
+
+	secrets, err := fm.Secrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, s := range secrets {
+		found = found || s.Name == "legacy.feed"
+	}
+	if !found {
+		t.Errorf("Expect legacy.feed in secrets but got %v", secrets)
+	}
+
+	for _, name := range []string{"../tests/legacy.feed", "..", "config.json"} {
+		if _, err = fm.GetFeed(name); !errors.Is(err, FeedErrorInvalidName) {
+			t.Errorf("Expect %v for %q but got %v", FeedErrorInvalidName, name, err)
+		}
+	}
+
+	// Legacy feeds can be renamed to a valid name
+	if _, err = fm.RenameFeed("legacy.feed", "legacy.renamed"); !errors.Is(err, FeedErrorInvalidName) {
+		t.Errorf("Expect %v but got %v", FeedErrorInvalidName, err)
+	}
+	if _, err = fm.RenameFeed("legacy.feed", "legacy"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fm.GetFeed("legacy"); err != nil {
+		t.Error(err)
+	}
+}
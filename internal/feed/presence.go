@@ -0,0 +1,151 @@
+package feed
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+// Presence notifications sent to clients connecting with presence=true
+// when a device connects to a feed or disconnects from it. They are not
+// numbered, and not sent again when clients resume.
+const (
+	ActionJoin  = "join"
+	ActionLeave = "leave"
+)
+
+// maxDeviceNameLength is the maximum length of device names, longer names
+// are truncated
+const maxDeviceNameLength = 64
+
+// Device is a client connected to a feed with a websocket or an event
+// stream. Name is chosen by the client with the device query parameter.
+type Device struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	UserAgent string    `json:"useragent,omitempty"`
+	Connected time.Time `json:"connected"`
+}
+
+// newDevice returns the device connecting with request r
+func newDevice(r *http.Request) *Device {
+	name := []rune(r.URL.Query().Get("device"))
+	if len(name) > maxDeviceNameLength {
+		name = name[:maxDeviceNameLength]
+	}
+	return &Device{
+		ID:        uuid.NewString(),
+		Name:      string(name),
+		UserAgent: r.UserAgent(),
+		Connected: time.Now(),
+	}
+}
+
+// identify records the device connecting with request r, and whether it
+// asked to be notified of presence changes with the presence query parameter
+func (c *outbox) identify(r *http.Request) {
+	c.device = newDevice(r)
+	c.presence, _ = strconv.ParseBool(r.URL.Query().Get("presence"))
+}
+
+// join adds the device of c to the devices connected to feed feedName on
+// all replicas. The manager mutex must not be held, as presence
+// notifications are dispatched synchronously by LocalBus.
+func (m *WebSocketManager) join(feedName string, c *subscriber) {
+	if c.device == nil {
+		return
+	}
+	if m.bus == nil {
+		m.notifyPresence(feedName, ActionJoin, c.device)
+		return
+	}
+	if err := m.bus.Join(feedName, *c.device); err != nil {
+		wsL.Logger.Error("Unable to publish presence", slog.String("feedName", feedName), slog.String("error", err.Error()))
+	}
+}
+
+// leave removes the device of c from the devices connected to feed feedName
+// on all replicas. The manager mutex must not be held.
+func (m *WebSocketManager) leave(feedName string, c *subscriber) {
+	if c.device == nil {
+		return
+	}
+	if m.bus == nil {
+		m.notifyPresence(feedName, ActionLeave, c.device)
+		return
+	}
+	if err := m.bus.Leave(feedName, *c.device); err != nil {
+		wsL.Logger.Error("Unable to publish presence", slog.String("feedName", feedName), slog.String("error", err.Error()))
+	}
+}
+
+// notifyPresence sends a presence notification for device d received from
+// the bus to the clients of feed feedName that asked for it
+func (m *WebSocketManager) notifyPresence(feedName string, action string, d *Device) {
+	if d == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if fs, ok := m.feedSockets[feedName]; ok {
+		m.notifyPresenceLocked(fs, action, d)
+	}
+}
+
+// notifyPresenceLocked sends a presence notification for device d to the
+// clients of fs that asked for it. Clients too slow to receive it are
+// dropped on the next notification. The manager mutex must be held.
+func (m *WebSocketManager) notifyPresenceLocked(fs *FeedSockets, action string, d *Device) {
+	for _, c := range fs.websockets {
+		if !c.presence {
+			continue
+		}
+		b, err := c.encode(FeedNotification{Action: action, Device: d}, fs.feedName)
+		if err != nil {
+			continue
+		}
+		c.enqueue(message{data: b})
+	}
+}
+
+// Presence returns the devices connected to feed feedName on all replicas,
+// by connection time
+func (m *WebSocketManager) Presence(feedName string) ([]Device, error) {
+	var result []Device
+	if m.bus == nil {
+		result = m.localDevices(feedName)
+	} else {
+		var err error
+		if result, err = m.bus.Devices(feedName); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Connected.Before(result[j].Connected)
+	})
+	return result, nil
+}
+
+// localDevices returns the devices connected to feed feedName on the
+// current replica
+func (m *WebSocketManager) localDevices(feedName string) []Device {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := []Device{}
+	if fs, ok := m.feedSockets[feedName]; ok {
+		for _, c := range fs.websockets {
+			if c.device != nil {
+				result = append(result, *c.device)
+			}
+		}
+	}
+	return result
+}
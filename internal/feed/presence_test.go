@@ -0,0 +1,73 @@
+package feed
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+func TestPresence(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+
+	dial := func(query string, userAgent string) *ws.Conn {
+		header := http.Header{}
+		header.Set("User-Agent", userAgent)
+		c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?"+query, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	next := func(c *ws.Conn) FeedNotification {
+		t.Helper()
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var n FeedNotification
+		if err := c.ReadJSON(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	watcher := dial("presence=true&device=desktop", "watcher")
+	defer watcher.Close()
+	if n := next(watcher); n.Action != ActionJoin || n.Device == nil || n.Device.Name != "desktop" {
+		t.Fatalf("Expect own join but got %+v", n)
+	}
+
+	laptop := dial("device="+strings.Repeat("x", maxDeviceNameLength+1), "laptop")
+	n := next(watcher)
+	if n.Action != ActionJoin || n.Device == nil || n.Device.UserAgent != "laptop" || len(n.Device.Name) != maxDeviceNameLength {
+		t.Fatalf("Expect laptop join but got %+v", n)
+	}
+	joined := *n.Device
+
+	presence, err := m.Presence(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(presence) != 2 || presence[0].Name != "desktop" || presence[1].ID != joined.ID {
+		t.Fatalf("Unexpected presence %+v", presence)
+	}
+
+	// Clients that didn't ask for presence only get feed notifications
+	if err := f.AddItem("text/plain", "", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(laptop); n.Action != "add" {
+		t.Fatalf("Expect add but got %+v", n)
+	}
+	if n := next(watcher); n.Action != "add" {
+		t.Fatalf("Expect add but got %+v", n)
+	}
+
+	laptop.Close()
+	if n := next(watcher); n.Action != ActionLeave || n.Device == nil || n.Device.ID != joined.ID {
+		t.Fatalf("Expect laptop leave but got %+v", n)
+	}
+	if presence, err = m.Presence(f.Name()); err != nil || len(presence) != 1 || presence[0].Name != "desktop" {
+		t.Fatalf("Unexpected presence %+v", presence)
+	}
+}
@@ -0,0 +1,376 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/exp/slog"
+)
+
+// DefaultBusChannel is the Redis channel notifications are published on
+const DefaultBusChannel = "ybfeed"
+
+// busTimeout is the time allowed to Redis operations
+const busTimeout = 5 * time.Second
+
+// presenceTTL is the time after which devices that weren't refreshed by
+// their replica are removed from presence, like when it crashed. Replicas
+// refresh their devices three times per presenceTTL.
+const presenceTTL = time.Minute
+
+var (
+	BusErrorInvalidURL = errors.New("invalid bus URL")
+	BusErrorConnection = errors.New("unable to connect to bus")
+)
+
+// publishScript numbers a notification with the sequence of its feed, in
+// KEYS[1], and publishes it on channel ARGV[1] as the sequence followed by
+// a space and busMessage ARGV[2]. The sequence and the presence of the
+// feed, in KEYS[3], are moved to KEYS[2] and KEYS[4] when ARGV[3] is
+// "rename", and removed when it is "delete". Redis runs scripts atomically,
+// so notifications are published in sequence.
+var publishScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+redis.call('PUBLISH', ARGV[1], seq .. ' ' .. ARGV[2])
+if ARGV[3] == 'rename' then
+	redis.call('RENAME', KEYS[1], KEYS[2])
+	if redis.call('EXISTS', KEYS[3]) == 1 then
+		redis.call('RENAME', KEYS[3], KEYS[4])
+	else
+		redis.call('DEL', KEYS[4])
+	end
+elseif ARGV[3] == 'delete' then
+	redis.call('DEL', KEYS[1], KEYS[3])
+end
+return seq
+`)
+
+// joinScript adds device ARGV[2] to the presence of a feed, in sorted set
+// KEYS[1] scored by expiration time ARGV[3] in milliseconds, after removing
+// devices that expired at ARGV[4]. When the device wasn't present and
+// ARGV[5] isn't empty, busMessage ARGV[5] is published on channel ARGV[1]
+// with sequence 0.
+var joinScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[4])
+local added = redis.call('ZADD', KEYS[1], ARGV[3], ARGV[2])
+redis.call('PEXPIREAT', KEYS[1], ARGV[3])
+if added == 1 and ARGV[5] ~= '' then
+	redis.call('PUBLISH', ARGV[1], '0 ' .. ARGV[5])
+end
+return added
+`)
+
+// leaveScript removes device ARGV[2] from the presence of a feed, in
+// KEYS[1], and publishes busMessage ARGV[3] on channel ARGV[1] with
+// sequence 0 if it was present
+var leaveScript = redis.NewScript(`
+local removed = redis.call('ZREM', KEYS[1], ARGV[2])
+if removed == 1 then
+	redis.call('PUBLISH', ARGV[1], '0 ' .. ARGV[3])
+end
+return removed
+`)
+
+// busMessage is a notification published on Redis, its sequence is
+// published separately by publishScript
+type busMessage struct {
+	Feed         string           `json:"feed"`
+	Notification FeedNotification `json:"notification"`
+}
+
+// RedisBus is a Bus publishing notifications on a Redis channel. Redis
+// delivers messages to all subscribers in the order it receives them.
+// Sequences of feeds are kept in Redis, notifications published while a
+// replica is disconnected from Redis are lost for its clients, which
+// receive a resync when they resume.
+//
+// Devices connected to each feed are kept in Redis too, and refreshed by the
+// replica they are connected to. Devices of a replica that stopped without
+// disconnecting them expire after presenceTTL, without leave notification.
+type RedisBus struct {
+	client  *redis.Client
+	channel string
+
+	mutex   sync.Mutex
+	pubsubs []*redis.PubSub
+	// devices are the devices that joined through this replica by feed,
+	// with their Redis member
+	devices map[string]map[string]string
+	done    chan struct{}
+}
+
+// NewRedisBus connects to the Redis server at url, like
+// redis://localhost:6379/0, and returns a RedisBus using channel
+func NewRedisBus(url string, channel string) (*RedisBus, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", BusErrorInvalidURL, err.Error())
+	}
+
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	if err = client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%w: %s", BusErrorConnection, err.Error())
+	}
+
+	b := &RedisBus{
+		client:  client,
+		channel: channel,
+		devices: map[string]map[string]string{},
+		done:    make(chan struct{}),
+	}
+	go b.refreshDevices()
+
+	return b, nil
+}
+
+// Publish numbers notification n of feed feedName and sends it on the
+// Redis channel
+func (b *RedisBus) Publish(feedName string, n FeedNotification) error {
+	msg, err := json.Marshal(busMessage{Feed: feedName, Notification: n})
+	if err != nil {
+		return err
+	}
+
+	keys := []string{b.seqKey(feedName), b.seqKey(feedName), b.presenceKey(feedName), b.presenceKey(feedName)}
+	op := ""
+	switch n.Action {
+	case ActionRenamed:
+		keys[1] = b.seqKey(n.Name)
+		keys[3] = b.presenceKey(n.Name)
+		op = "rename"
+	case ActionClosed:
+		op = "delete"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	return publishScript.Run(ctx, b.client, keys, b.channel, msg, op).Err()
+}
+
+// seqKey returns the Redis key holding the sequence of feed feedName
+func (b *RedisBus) seqKey(feedName string) string {
+	return b.channel + ":seq:" + feedName
+}
+
+// presenceKey returns the Redis key holding the devices connected to feed
+// feedName
+func (b *RedisBus) presenceKey(feedName string) string {
+	return b.channel + ":presence:" + feedName
+}
+
+// Join adds device d to the devices of feed feedName in Redis, and
+// publishes a join notification. The device is refreshed until it leaves.
+func (b *RedisBus) Join(feedName string, d Device) error {
+	member, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(busMessage{Feed: feedName, Notification: FeedNotification{Action: ActionJoin, Device: &d}})
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	if b.devices[feedName] == nil {
+		b.devices[feedName] = map[string]string{}
+	}
+	b.devices[feedName][d.ID] = string(member)
+	b.mutex.Unlock()
+
+	return b.join(feedName, string(member), string(msg))
+}
+
+// join runs joinScript for Redis member of feed feedName, msg is published
+// if it isn't empty and the member wasn't present
+func (b *RedisBus) join(feedName string, member string, msg string) error {
+	now := time.Now()
+	expires := now.Add(presenceTTL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	return joinScript.Run(ctx, b.client, []string{b.presenceKey(feedName)},
+		b.channel, member, expires.UnixMilli(), now.UnixMilli(), msg).Err()
+}
+
+// Leave removes device d from the devices of feed feedName in Redis, and
+// publishes a leave notification
+func (b *RedisBus) Leave(feedName string, d Device) error {
+	member, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(busMessage{Feed: feedName, Notification: FeedNotification{Action: ActionLeave, Device: &d}})
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	delete(b.devices[feedName], d.ID)
+	if len(b.devices[feedName]) == 0 {
+		delete(b.devices, feedName)
+	}
+	b.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	return leaveScript.Run(ctx, b.client, []string{b.presenceKey(feedName)}, b.channel, member, msg).Err()
+}
+
+// Devices returns the devices of feed feedName in Redis that didn't expire
+func (b *RedisBus) Devices(feedName string) ([]Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	members, err := b.client.ZRangeByScore(ctx, b.presenceKey(feedName), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []Device{}
+	for _, member := range members {
+		var d Device
+		if err = json.Unmarshal([]byte(member), &d); err != nil {
+			wsL.Logger.Error("Invalid presence member", slog.String("error", err.Error()))
+			continue
+		}
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// refreshDevices extends the expiration of devices that joined through this
+// replica until the bus is closed
+func (b *RedisBus) refreshDevices() {
+	ticker := time.NewTicker(presenceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+
+		b.mutex.Lock()
+		members := map[string][]string{}
+		for feedName, devices := range b.devices {
+			for _, member := range devices {
+				members[feedName] = append(members[feedName], member)
+			}
+		}
+		b.mutex.Unlock()
+
+		for feedName, feedMembers := range members {
+			for _, member := range feedMembers {
+				if err := b.join(feedName, member, ""); err != nil {
+					wsL.Logger.Error("Unable to refresh presence", slog.String("feedName", feedName), slog.String("error", err.Error()))
+				}
+			}
+		}
+	}
+}
+
+// followFeed updates the devices that joined through this replica when
+// notification n of feed feedName renames or closes it
+func (b *RedisBus) followFeed(feedName string, n FeedNotification) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch n.Action {
+	case ActionRenamed:
+		if devices, ok := b.devices[feedName]; ok {
+			b.devices[n.Name] = devices
+			delete(b.devices, feedName)
+		}
+	case ActionClosed:
+		delete(b.devices, feedName)
+	}
+}
+
+// parseBusMessage returns the feed and notification of payload received
+// on the Redis channel
+func parseBusMessage(payload string) (string, FeedNotification, error) {
+	seq, data, found := strings.Cut(payload, " ")
+	if !found {
+		return "", FeedNotification{}, errors.New("missing sequence")
+	}
+
+	var m busMessage
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		return "", FeedNotification{}, err
+	}
+
+	var err error
+	if m.Notification.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return "", FeedNotification{}, err
+	}
+
+	return m.Feed, m.Notification, nil
+}
+
+// Subscribe calls handler with the notifications received on the Redis
+// channel, from a dedicated goroutine
+func (b *RedisBus) Subscribe(handler BusHandler) error {
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+
+	pubsub := b.client.Subscribe(ctx, b.channel)
+
+	// Wait for the subscription to be confirmed, so that no notification
+	// published afterwards is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return fmt.Errorf("%w: %s", BusErrorConnection, err.Error())
+	}
+
+	b.mutex.Lock()
+	b.pubsubs = append(b.pubsubs, pubsub)
+	b.mutex.Unlock()
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			feedName, n, err := parseBusMessage(msg.Payload)
+			if err != nil {
+				wsL.Logger.Error("Invalid bus message", slog.String("error", err.Error()))
+				continue
+			}
+			b.followFeed(feedName, n)
+			handler(feedName, n)
+		}
+	}()
+
+	return nil
+}
+
+// Close stops subscriptions and disconnects from Redis
+func (b *RedisBus) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, pubsub := range b.pubsubs {
+		pubsub.Close()
+	}
+	b.pubsubs = nil
+
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+
+	return b.client.Close()
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package feed
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace moves oldPath to newPath, failing with an error matching
+// os.ErrExist if newPath already exists. The check is done atomically by the
+// kernel, unless the file system doesn't support RENAME_NOREPLACE.
+func renameNoReplace(oldPath string, newPath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_NOREPLACE)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOSYS) {
+		return renameChecked(oldPath, newPath)
+	}
+	return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package feed
+
+// renameNoReplace moves oldPath to newPath, failing with an error matching
+// os.ErrExist if newPath already exists
+func renameNoReplace(oldPath string, newPath string) error {
+	return renameChecked(oldPath, newPath)
+}
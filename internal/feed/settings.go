@@ -0,0 +1,205 @@
+package feed
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Appboy/webpush-go"
+	"golang.org/x/exp/slog"
+)
+
+// Notifications sent when the configuration of a feed changes. They hold
+// the FeedSettings of the feed after the change, except pinexpired.
+const (
+	ActionPIN           = "pin"
+	ActionPINExpired    = "pinexpired"
+	ActionSubscriptions = "subscriptions"
+	ActionSettings      = "settings"
+)
+
+// ActionSecretRotated is sent when the secret of a feed is replaced, without
+// the new secret. Websockets and event streams of the feed are then closed
+// with CloseSecretRotated, so that clients authenticate again.
+const ActionSecretRotated = "secretrotated"
+
+// FeedSettings is the configuration of a feed sent to clients when it
+// changes. It never holds secrets, PINs, tokens or subscription details.
+type FeedSettings struct {
+	Description   string     `json:"description,omitempty"`
+	Retention     Duration   `json:"retention,omitempty"`
+	PINExpiration *time.Time `json:"pinexpiration,omitempty"`
+	Subscriptions int        `json:"subscriptions"`
+}
+
+// Settings returns the current settings of the feed
+func (feed *Feed) Settings() FeedSettings {
+	result := FeedSettings{
+		Description:   feed.Config.Description,
+		Retention:     feed.Config.Retention,
+		Subscriptions: len(feed.Config.Subscriptions),
+	}
+	if feed.Config.PIN != nil && feed.Config.PIN.Expiration.After(time.Now()) {
+		expiration := feed.Config.PIN.Expiration
+		result.PINExpiration = &expiration
+	}
+	return result
+}
+
+// SetSettings updates the description and retention of the feed and
+// notifies clients
+func (feed *Feed) SetSettings(description string, retention Duration) error {
+	if retention < 0 {
+		return fmt.Errorf("%w: %s", FeedConfigErrorInvalidRetention, time.Duration(retention))
+	}
+	err := feed.Config.update(func(c *FeedConfig) error {
+		c.Description = description
+		c.Retention = retention
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	feed.notifySettings(ActionSettings)
+	return nil
+}
+
+// AddSubscription adds web push subscription s to the feed and notifies
+// clients
+func (feed *Feed) AddSubscription(s webpush.Subscription) error {
+	if err := feed.Config.AddSubscription(s); err != nil {
+		return err
+	}
+	feed.notifySettings(ActionSubscriptions)
+	return nil
+}
+
+// DeleteSubscription removes web push subscription s from the feed and
+// notifies clients
+func (feed *Feed) DeleteSubscription(s webpush.Subscription) error {
+	if err := feed.Config.DeleteSubscription(s); err != nil {
+		return err
+	}
+	feed.notifySettings(ActionSubscriptions)
+	return nil
+}
+
+// RotateSecret replaces the feed secret with a new random one, and closes
+// the websockets and event streams of the feed on all replicas
+func (feed *Feed) RotateSecret() error {
+	if err := feed.Config.RotateSecret(); err != nil {
+		return err
+	}
+	if feed.WebSocketManager == nil {
+		return nil
+	}
+	if err := feed.WebSocketManager.NotifySecretRotated(feed.Name()); err != nil {
+		fL.Logger.Error("Unable to notify secret rotation", slog.String("feed", feed.Path), slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// notifySettings sends the feed settings to clients with action. The
+// settings are already saved, errors are only logged.
+func (feed *Feed) notifySettings(action string) {
+	if feed.WebSocketManager == nil {
+		return
+	}
+	if err := feed.WebSocketManager.NotifySettings(feed.Name(), action, feed.Settings()); err != nil {
+		fL.Logger.Error("Unable to notify settings", slog.String("feed", feed.Path), slog.String("action", action), slog.String("error", err.Error()))
+	}
+}
+
+// NotifySettings notifies all connected websockets that the settings of
+// feed feedName changed. For the pin action, a pinexpired notification is
+// sent when the PIN expires.
+func (m *WebSocketManager) NotifySettings(feedName string, action string, settings FeedSettings) error {
+	if action == ActionPIN && settings.PINExpiration != nil {
+		m.expirePIN(feedName, *settings.PINExpiration)
+	}
+	return m.publish(feedName, FeedNotification{
+		Action:   action,
+		Settings: &settings,
+	})
+}
+
+// NotifySecretRotated notifies all connected websockets that the secret of
+// feed feedName was replaced, and closes them
+func (m *WebSocketManager) NotifySecretRotated(feedName string) error {
+	return m.publish(feedName, FeedNotification{
+		Action: ActionSecretRotated,
+	})
+}
+
+// secretRotated sends notification n of the secret rotation of feed
+// feedName to websockets of the current process, and closes them. The event
+// log is kept, so that clients resume after they authenticate again.
+func (m *WebSocketManager) secretRotated(feedName string, n FeedNotification) {
+	if err := m.broadcast(feedName, n); err != nil {
+		wsL.Logger.Error("Unable to notify websocket", slog.String("feedName", feedName), slog.String("error", err.Error()))
+	}
+
+	m.mutex.Lock()
+	var conns, tagged []*subscriber
+	if fs, ok := m.feedSockets[feedName]; ok {
+		delete(m.feedSockets, feedName)
+		conns = append(conns, fs.websockets...)
+		// Websockets connected to several feeds stay connected, they
+		// leave the feed now
+		for _, c := range conns {
+			if c.tagged {
+				fs.removeConn(c)
+				tagged = append(tagged, c)
+			}
+		}
+	}
+	m.mutex.Unlock()
+
+	closeSubscribers(feedName, conns, CloseSecretRotated, "secret rotated")
+	for _, c := range tagged {
+		m.leave(feedName, c)
+	}
+}
+
+// pinTimer notifies clients of a feed when its PIN expires
+type pinTimer struct {
+	timer *time.Timer
+
+	// feedName changes when the feed is renamed, it is protected by the
+	// WebSocketManager mutex
+	feedName string
+}
+
+// expirePIN schedules a pinexpired notification of feed feedName at
+// expiration, replacing the one of a previous PIN
+func (m *WebSocketManager) expirePIN(feedName string, expiration time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.pinTimers == nil {
+		m.pinTimers = map[string]*pinTimer{}
+	}
+	if previous, ok := m.pinTimers[feedName]; ok {
+		previous.timer.Stop()
+	}
+
+	p := &pinTimer{feedName: feedName}
+	p.timer = time.AfterFunc(time.Until(expiration), func() {
+		m.mutex.Lock()
+		name := p.feedName
+		current := m.pinTimers[name] == p
+		if current {
+			delete(m.pinTimers, name)
+		}
+		m.mutex.Unlock()
+
+		// The PIN was replaced, or the feed deleted
+		if !current {
+			return
+		}
+
+		if err := m.publish(name, FeedNotification{Action: ActionPINExpired}); err != nil {
+			wsL.Logger.Error("Unable to publish PIN expiration", slog.String("feedName", name), slog.String("error", err.Error()))
+		}
+	})
+	m.pinTimers[feedName] = p
+}
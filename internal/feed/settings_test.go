@@ -0,0 +1,151 @@
+package feed
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Appboy/webpush-go"
+	ws "github.com/gorilla/websocket"
+)
+
+func TestSettingsNotifications(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+	c := dialWebSocket(t, server)
+	defer c.Close()
+	waitForCount(t, m, f.Name(), 1)
+
+	next := func() (FeedNotification, string) {
+		t.Helper()
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n FeedNotification
+		if err = json.Unmarshal(data, &n); err != nil {
+			t.Fatal(err)
+		}
+		return n, string(data)
+	}
+
+	// PIN notifications hold the expiration but never the PIN
+	if err := f.SetPIN("1234"); err != nil {
+		t.Fatal(err)
+	}
+	n, raw := next()
+	if n.Action != ActionPIN || n.Settings == nil || n.Settings.PINExpiration == nil {
+		t.Fatalf("Expect pin notification but got %s", raw)
+	}
+	if strings.Contains(raw, "1234") || strings.Contains(raw, f.Config.Secret) {
+		t.Fatalf("Notification leaks secrets: %s", raw)
+	}
+
+	if err := f.SetSettings("shared notes", Duration(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	n, raw = next()
+	if n.Action != ActionSettings || n.Settings == nil || n.Settings.Description != "shared notes" || n.Settings.Retention != Duration(time.Hour) {
+		t.Fatalf("Expect settings notification but got %s", raw)
+	}
+	if err := f.SetSettings("", -1); err == nil {
+		t.Fatal("Expect error with negative retention")
+	}
+
+	s := webpush.Subscription{Endpoint: "https://push.example.com/device"}
+	if err := f.AddSubscription(s); err != nil {
+		t.Fatal(err)
+	}
+	n, raw = next()
+	if n.Action != ActionSubscriptions || n.Settings == nil || n.Settings.Subscriptions != 1 {
+		t.Fatalf("Expect subscriptions notification but got %s", raw)
+	}
+	if strings.Contains(raw, s.Endpoint) {
+		t.Fatalf("Notification leaks subscription: %s", raw)
+	}
+	if err := f.DeleteSubscription(s); err != nil {
+		t.Fatal(err)
+	}
+	if n, raw = next(); n.Action != ActionSubscriptions || n.Settings == nil || n.Settings.Subscriptions != 0 {
+		t.Fatalf("Expect subscriptions notification but got %s", raw)
+	}
+
+	// A pinexpired notification is sent when the PIN expires
+	expiration := time.Now().Add(50 * time.Millisecond)
+	if err := m.NotifySettings(f.Name(), ActionPIN, FeedSettings{PINExpiration: &expiration}); err != nil {
+		t.Fatal(err)
+	}
+	if n, raw = next(); n.Action != ActionPIN {
+		t.Fatalf("Expect pin notification but got %s", raw)
+	}
+	if n, raw = next(); n.Action != ActionPINExpired || n.Settings != nil {
+		t.Fatalf("Expect pinexpired notification but got %s", raw)
+	}
+}
+
+func TestRotateSecretNotification(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+	previous := f.Config.Secret
+
+	c := dialWebSocket(t, server)
+	defer c.Close()
+
+	multiplexed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.RunSocket(authorizeSecret(m.FeedManager), w, r)
+	}))
+	defer multiplexed.Close()
+	mc := dialWebSocket(t, multiplexed)
+	defer mc.Close()
+	if r := sendCommand(t, mc, Command{ID: "1", Command: CommandSubscribe, Feed: f.Name(), Secret: previous}); r.Error != nil {
+		t.Fatalf("Unexpected error %v", r.Error)
+	}
+	waitForCount(t, m, f.Name(), 2)
+
+	if err := f.RotateSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Config.Secret == previous {
+		t.Fatal("Secret has not been replaced")
+	}
+
+	// The notification never holds the secret, and is followed by the
+	// feed being closed
+	_ = mc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := mc.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n FeedNotification
+	if err = json.Unmarshal(data, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Action != ActionSecretRotated || n.Feed != f.Name() {
+		t.Fatalf("Expect secretrotated notification but got %s", data)
+	}
+	if strings.Contains(string(data), f.Config.Secret) || strings.Contains(string(data), previous) {
+		t.Fatalf("Notification leaks secrets: %s", data)
+	}
+	if n = readTagged(t, mc); n.Action != ActionClosed || n.Code != CloseSecretRotated {
+		t.Fatalf("Expect closed notification but got %+v", n)
+	}
+
+	// Websockets connected to the feed only are closed
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err = c.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if !ws.IsCloseError(err, CloseSecretRotated) {
+		t.Fatalf("Expect close code %d but got %v", CloseSecretRotated, err)
+	}
+	waitForCount(t, m, f.Name(), 0)
+
+	// The notification is kept for clients resuming
+	if m.Seq(f.Name()) != 1 {
+		t.Errorf("Expect sequence 1 but got %d", m.Seq(f.Name()))
+	}
+}
@@ -0,0 +1,192 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Scope is a permission granted to the holder of a feed secret or token
+type Scope string
+
+// Available scopes. ScopeAdmin implies every other scope and is the only one
+// allowing access to the feed secret itself.
+const (
+	ScopeRead   Scope = "read"
+	ScopeWrite  Scope = "write"
+	ScopeDelete Scope = "delete"
+	ScopeAdmin  Scope = "admin"
+)
+
+// Errors related to feed tokens
+var (
+	FeedErrorInsufficientScope = errors.New("insufficient scope")
+	FeedErrorInvalidScope      = errors.New("invalid scope")
+	FeedErrorTokenNotFound     = errors.New("token not found")
+)
+
+// ParseScope returns the Scope named s, or an error if s isn't a known scope
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin:
+		return Scope(s), nil
+	}
+	return "", fmt.Errorf("%w: %s", FeedErrorInvalidScope, s)
+}
+
+// Scopes is the list of permissions granted by a secret
+type Scopes []Scope
+
+// Has returns true if scope is granted, either explicitly or because admin
+// scope is present
+func (s Scopes) Has(scope Scope) bool {
+	for _, v := range s {
+		if v == scope || v == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Token is a secondary secret giving restricted access to a feed, typically
+// used to share read-only or write-only links
+type Token struct {
+	Token  string `json:"token"`
+	Name   string `json:"name,omitempty"`
+	Scopes Scopes `json:"scopes"`
+}
+
+// AddToken creates a new random token with the given scopes and saves
+// feed configuration
+func (config *FeedConfig) AddToken(name string, scopes Scopes) (*Token, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: no scope provided", FeedErrorInvalidScope)
+	}
+	for _, s := range scopes {
+		if _, err := ParseScope(string(s)); err != nil {
+			return nil, err
+		}
+	}
+
+	token := Token{
+		Token:  uuid.NewString(),
+		Name:   name,
+		Scopes: scopes,
+	}
+
+	err := config.update(func(c *FeedConfig) error {
+		c.Tokens = append(c.Tokens, token)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// DeleteToken revokes token and saves feed configuration
+func (config *FeedConfig) DeleteToken(token string) error {
+	return config.update(func(c *FeedConfig) error {
+		keepTokens := []Token{}
+		found := false
+
+		for _, t := range c.Tokens {
+			if t.Token == token {
+				found = true
+				continue
+			}
+			keepTokens = append(keepTokens, t)
+		}
+
+		if !found {
+			return fmt.Errorf("%w: %s", FeedErrorTokenNotFound, token)
+		}
+
+		c.Tokens = keepTokens
+		return nil
+	})
+}
+
+// ScopesForSecret returns the scopes granted by secret, which can be the feed
+// secret, a PIN or a token. An error is returned if secret doesn't allow any
+// access to the feed.
+func (feed *Feed) ScopesForSecret(secret string) (Scopes, error) {
+	if secret == "" {
+		return nil, FeedErrorInvalidSecret
+	}
+
+	if len(secret) == 4 { // Secret is a PIN
+		if feed.Config.PIN == nil {
+			fL.Logger.Error(FeedConfigErrorPinIncorrect.Error())
+			return nil, FeedConfigErrorPinIncorrect
+		}
+		err := feed.Config.PIN.IsValid(secret)
+		if err != nil {
+			fL.Logger.Error(err.Error())
+			return nil, err
+		}
+		return Scopes{ScopeAdmin}, nil
+	}
+
+	if feed.Config.Secret == secret {
+		return Scopes{ScopeAdmin}, nil
+	}
+
+	for _, t := range feed.Config.Tokens {
+		if t.Token == secret {
+			return t.Scopes, nil
+		}
+	}
+
+	fL.Logger.Error(FeedErrorIncorrectSecret.Error())
+	return nil, FeedErrorIncorrectSecret
+}
+
+// ScopesForUser returns the scopes granted to an authenticated user, who
+// doesn't need to provide a secret for feeds they own or are member of
+func (feed *Feed) ScopesForUser(user string) Scopes {
+	return feed.RoleForUser(user).Scopes()
+}
+
+// ScopesFor returns the scopes granted to a request authenticated with secret
+// and/or user
+func (feed *Feed) ScopesFor(secret string, user string) (Scopes, error) {
+	userScopes := feed.ScopesForUser(user)
+
+	scopes, err := feed.ScopesForSecret(secret)
+	if err != nil {
+		if userScopes != nil {
+			return userScopes, nil
+		}
+		return nil, err
+	}
+
+	return append(scopes, userScopes...), nil
+}
+
+// Authorize returns an error if neither user nor secret grant scope on the
+// feed
+func (feed *Feed) Authorize(secret string, user string, scope Scope) error {
+	scopes, err := feed.ScopesFor(secret, user)
+	if err != nil {
+		return err
+	}
+	if !scopes.Has(scope) {
+		return fmt.Errorf("%w: %s", FeedErrorInsufficientScope, scope)
+	}
+	return nil
+}
+
+// HasScope returns an error if secret doesn't grant scope on the feed
+func (feed *Feed) HasScope(secret string, scope Scope) error {
+	scopes, err := feed.ScopesForSecret(secret)
+	if err != nil {
+		return err
+	}
+	if !scopes.Has(scope) {
+		return fmt.Errorf("%w: %s", FeedErrorInsufficientScope, scope)
+	}
+	return nil
+}
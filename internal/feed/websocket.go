@@ -1,13 +1,17 @@
 package feed
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	ws "github.com/gorilla/websocket"
-	"github.com/ybizeul/ybfeed/internal/utils"
 	"github.com/ybizeul/ybfeed/pkg/yblog"
 	"golang.org/x/exp/slog"
 )
@@ -17,196 +21,802 @@ var wsL = yblog.NewYBLogger("push", []string{"DEBUG", "DEBUG_WEBSOCKET"})
 // upgrader is used to upgrade a connection to a websocket
 var upgrader = ws.Upgrader{} // use default options
 
-// FeedSockets maintains a list of active websockets for a specific feed
-// designated by feedName
+// CloseFeedDeleted is the websocket close code sent to clients when their
+// feed is deleted
+const CloseFeedDeleted = 4410
+
+// CloseSecretRotated is the websocket close code sent to clients when the
+// secret of their feed is replaced
+const CloseSecretRotated = 4401
+
+// DefaultSendBufferSize is the number of messages queued for a websocket
+// before the client is considered too slow and disconnected
+const DefaultSendBufferSize = 64
+
+// DefaultMaxSubscriptions is the number of feeds a multiplexed websocket can
+// subscribe to
+const DefaultMaxSubscriptions = 100
+
+// Default websocket heartbeat settings. A ping is sent every
+// DefaultPingInterval, and connections that don't answer within
+// DefaultPongWait are closed.
+const (
+	DefaultPingInterval = 30 * time.Second
+	DefaultPongWait     = 60 * time.Second
+	DefaultWriteTimeout = 10 * time.Second
+)
+
+// message is a message queued for a client, seq is the sequence of the
+// notification it holds, if any
+type message struct {
+	seq  uint64
+	data []byte
+}
+
+// outbox is the queue of messages of a client connection. Messages are
+// written by a dedicated goroutine, as connections don't support concurrent
+// writers.
+type outbox struct {
+	send chan message
+	done chan struct{}
+
+	// device is the client connected, nil if it isn't reported in
+	// presence, and presence is true if it is notified when devices join
+	// or leave
+	device   *Device
+	presence bool
+
+	once        sync.Once
+	closeCode   int
+	closeReason string
+}
+
+// subscriber is a client receiving notifications of a feed, over a
+// websocket or an event stream. Subscribers of a websocket connected to
+// several feeds share its outbox, and their notifications are tagged with
+// the feed name.
+type subscriber struct {
+	*outbox
+	tagged bool
+
+	// Sequences of the first and last notifications queued, protected by
+	// the WebSocketManager mutex
+	firstSeq uint64
+	lastSeq  uint64
+}
+
+// enqueue queues msg for writing. It returns false if the subscriber is
+// stopped or its queue is full.
+func (c *outbox) enqueue(msg message) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendJSON marshals v and queues it for writing. It returns false if the
+// queue is full.
+func (c *outbox) sendJSON(v any) bool {
+	b, err := json.Marshal(v)
+	if err != nil {
+		wsL.Logger.Error("Unable to marshal message", slog.String("error", err.Error()))
+		return true
+	}
+	return c.enqueue(message{data: b})
+}
+
+// stop closes the connection, with a close message if code isn't zero
+func (c *outbox) stop(code int, reason string) {
+	c.once.Do(func() {
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.done)
+	})
+}
+
+// writeWebSocket writes messages queued for c on websocket conn until c is
+// stopped or a write fails, then closes the connection
+func (m *WebSocketManager) writeWebSocket(c *subscriber, conn *ws.Conn) {
+	pingInterval := durationOrDefault(m.PingInterval, DefaultPingInterval)
+	writeTimeout := durationOrDefault(m.WriteTimeout, DefaultWriteTimeout)
+
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := conn.WriteMessage(ws.TextMessage, msg.data); err != nil {
+				wsL.Logger.Debug("Unable to write to websocket", slog.String("error", err.Error()))
+				c.stop(0, "")
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(ws.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				wsL.Logger.Debug("Unable to ping websocket", slog.String("error", err.Error()))
+				c.stop(0, "")
+				return
+			}
+		case <-c.done:
+			if c.closeCode != 0 {
+				msg := ws.FormatCloseMessage(c.closeCode, c.closeReason)
+				if err := conn.WriteControl(ws.CloseMessage, msg, time.Now().Add(writeTimeout)); err != nil {
+					wsL.Logger.Debug("Unable to close websocket", slog.String("error", err.Error()))
+				}
+			}
+			return
+		}
+	}
+}
+
+// FeedSockets maintains a list of active websockets and event streams for a
+// specific feed designated by feedName
 type FeedSockets struct {
 	feedName   string
-	websockets []*ws.Conn
+	websockets []*subscriber
 }
 
-// RemoveConn removes the websocket c from the list of active websockets
-func (fs *FeedSockets) RemoveConn(c *ws.Conn) {
-	wsL.Logger.Debug("Removing connection",
-		slog.Int("count", len(fs.websockets)),
-		slog.Any("connections", fs.websockets),
-		slog.String("connection", fmt.Sprintf("%p", c)))
+// removeConn removes the websocket c from the list of active websockets,
+// and returns false if it wasn't in the list
+func (fs *FeedSockets) removeConn(c *subscriber) bool {
 	for i, conn := range fs.websockets {
-		wsL.Logger.Debug("Current connection", slog.String("connection", fmt.Sprintf("%p", conn)))
 		if conn == c {
-			wsL.Logger.Debug("Found connection", slog.String("connection", fmt.Sprintf("%p", conn)))
 			fs.websockets[i] = fs.websockets[len(fs.websockets)-1]
 			fs.websockets = fs.websockets[:len(fs.websockets)-1]
+			return true
 		}
 	}
+	return false
 }
 
 // FeedNotification is used to marshall notification information message
-// to the push service
+// to the push service. Seq increases with each notification of a feed.
+// Feed is set on websockets connected to several feeds, and on renamed
+// notifications with the previous name of the feed.
 type FeedNotification struct {
-	Action string         `json:"action"`
-	Item   PublicFeedItem `json:"item"`
+	Feed     string         `json:"feed,omitempty"`
+	Action   string         `json:"action"`
+	Item     PublicFeedItem `json:"item"`
+	Name     string         `json:"name,omitempty"`
+	Seq      uint64         `json:"seq,omitempty"`
+	Code     int            `json:"code,omitempty"`
+	Reason   string         `json:"reason,omitempty"`
+	Device   *Device        `json:"device,omitempty"`
+	Settings *FeedSettings  `json:"settings,omitempty"`
 }
 
-// WebSocketManager bridges a FeedManager with a FeedSockets struct
+// ActionResync is sent to a client resuming from a sequence that isn't in
+// the event log anymore. It should download the whole feed again.
+const ActionResync = "resync"
+
+// ActionClosed is sent to websockets connected to several feeds when one of
+// them is closed, with the code and reason it would be closed with
+const ActionClosed = "closed"
+
+// ActionRenamed is sent when a feed is renamed, with its new name
+const ActionRenamed = "renamed"
+
+// encode marshals n for c, tagged with feedName if c is connected to
+// several feeds
+func (c *subscriber) encode(n FeedNotification, feedName string) ([]byte, error) {
+	if c.tagged && n.Feed == "" {
+		n.Feed = feedName
+	}
+	return json.Marshal(n)
+}
+
+// closeSubscribers stops conns of feed feedName with code and reason.
+// Websockets connected to several feeds are notified instead, and stay
+// connected to the other feeds.
+func closeSubscribers(feedName string, conns []*subscriber, code int, reason string) {
+	for _, c := range conns {
+		if !c.tagged {
+			c.stop(code, reason)
+			continue
+		}
+		if !c.sendJSON(FeedNotification{Feed: feedName, Action: ActionClosed, Code: code, Reason: reason}) {
+			c.stop(ws.CloseTryAgainLater, "too slow")
+		}
+	}
+}
+
+// websocketFeed is the feed content sent on websockets, with the sequence
+// of the last notification it includes
+type websocketFeed struct {
+	*PublicFeed
+	Seq uint64 `json:"seq"`
+}
+
+// WebSocketManager bridges a FeedManager with the websockets connected to
+// its feeds. Its methods are safe for concurrent use.
 type WebSocketManager struct {
-	FeedSockets []*FeedSockets
 	FeedManager *FeedManager
+
+	// EventLogSize is the number of notifications kept for each feed to let
+	// clients resume, DefaultEventLogSize when zero.
+	EventLogSize int
+
+	// SendBufferSize is the number of messages queued for each websocket,
+	// DefaultSendBufferSize when zero. Clients falling behind are
+	// disconnected.
+	SendBufferSize int
+
+	// PingInterval is the delay between pings sent to clients, PongWait the
+	// time after which a client that didn't answer is considered dead, and
+	// WriteTimeout the time allowed to write a message. Defaults are used
+	// when they are zero.
+	PingInterval time.Duration
+	PongWait     time.Duration
+	WriteTimeout time.Duration
+
+	// MaxItemSize is the maximum size of items added with websocket
+	// commands, unlimited when zero
+	MaxItemSize int64
+
+	// MaxSubscriptions is the number of feeds a multiplexed websocket can
+	// subscribe to, DefaultMaxSubscriptions when zero
+	MaxSubscriptions int
+
+	// bus carries notifications to all replicas, they are dispatched to
+	// the current process when it is nil
+	bus Bus
+
+	mutex       sync.Mutex
+	feedSockets map[string]*FeedSockets
+	eventLogs   map[string]*eventLog
+	pinTimers   map[string]*pinTimer
+	reaped      atomic.Int64
 }
 
 // NewWebSocketManager creates a new WebSocketManager. There is typically one
 // WebSocketManager per ybFeed deployment.
 func NewWebSocketManager(fm *FeedManager) *WebSocketManager {
-	return &WebSocketManager{
+	m := &WebSocketManager{
 		FeedManager: fm,
 	}
+	// LocalBus never fails
+	_ = m.UseBus(NewLocalBus())
+	return m
 }
 
-// FeedSocketsForFeed returns the FeedSockets for feed feedName
-func (m *WebSocketManager) FeedSocketsForFeed(feedName string) *FeedSockets {
-	wsL.Logger.Debug("Searching FeedSockets", slog.Int("count", len(m.FeedSockets)), slog.String("feedName", feedName))
-
-	// Loop through all FeedSockets to find the one for this feed
-	for _, fs := range m.FeedSockets {
-		if fs.feedName == feedName {
-			return fs
+// UseBus makes m publish notifications on bus b, and send notifications
+// received from b to its websockets. The previous bus is closed. It must be
+// called before websockets connect.
+func (m *WebSocketManager) UseBus(b Bus) error {
+	if err := b.Subscribe(m.dispatch); err != nil {
+		return err
+	}
+	if m.bus != nil {
+		if err := m.bus.Close(); err != nil {
+			wsL.Logger.Error("Unable to close bus", slog.String("error", err.Error()))
 		}
 	}
+	m.bus = b
 	return nil
 }
 
-// RunSocketForFeed promotes an HTTP connection to a websocket and starts
-// waiting for data. This function is blocking and typically runs from
-// a http handler.
-func (m *WebSocketManager) RunSocketForFeed(feedName string, w http.ResponseWriter, r *http.Request) {
-	// Check if we already have websockets for this feed
-	feedSockets := m.FeedSocketsForFeed(feedName)
-
-	if feedSockets == nil { // No, then we create a new FeedSockets
-		wsL.Logger.Debug("Adding FeedSockets", slog.Int("count_before", len(m.FeedSockets)), slog.String("feedName", feedName))
-		feedSockets = &FeedSockets{
-			feedName: feedName,
+// publish sends notification n of feed feedName to all replicas
+func (m *WebSocketManager) publish(feedName string, n FeedNotification) error {
+	if m.bus == nil {
+		m.dispatch(feedName, n)
+		return nil
+	}
+	return m.bus.Publish(feedName, n)
+}
+
+// dispatch sends notification n of feed feedName received from the bus to
+// the websockets of the current process
+func (m *WebSocketManager) dispatch(feedName string, n FeedNotification) {
+	switch n.Action {
+	case ActionRenamed:
+		m.renameFeed(feedName, n)
+	case ActionClosed:
+		m.closeFeed(feedName, n.Code, n.Reason)
+	case ActionJoin, ActionLeave:
+		m.notifyPresence(feedName, n.Action, n.Device)
+	case ActionSecretRotated:
+		m.secretRotated(feedName, n)
+	default:
+		if err := m.broadcast(feedName, n); err != nil {
+			wsL.Logger.Error("Unable to notify websocket", slog.String("feedName", feedName), slog.String("error", err.Error()))
 		}
-		m.FeedSockets = append(m.FeedSockets, feedSockets)
 	}
+}
 
-	// Upgrade http connection to websocket
-	c, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		utils.CloseWithCodeAndMessage(w, 500, "Unable to upgrade WebSocket")
+// sendBufferSize returns the size of websockets queues
+func (m *WebSocketManager) sendBufferSize() int {
+	if m.SendBufferSize > 0 {
+		return m.SendBufferSize
 	}
+	return DefaultSendBufferSize
+}
 
-	feedSockets.websockets = append(feedSockets.websockets, c)
+func (m *WebSocketManager) maxSubscriptions() int {
+	if m.MaxSubscriptions > 0 {
+		return m.MaxSubscriptions
+	}
+	return DefaultMaxSubscriptions
+}
 
-	// Get provided secret and validate feed access
-	secret, _ := utils.GetSecret(r)
+// newSubscriber returns a subscriber with the manager settings
+func (m *WebSocketManager) newSubscriber() *subscriber {
+	return &subscriber{
+		outbox: &outbox{
+			send: make(chan message, m.sendBufferSize()),
+			done: make(chan struct{}),
+		},
+	}
+}
 
-	f, err := m.FeedManager.GetFeedWithAuth(feedName, secret)
+// durationOrDefault returns d, or def if d isn't set
+func durationOrDefault(d time.Duration, def time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return def
+}
 
-	if err != nil {
-		switch {
-		case errors.Is(err, FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, "feed not found")
-		case errors.Is(err, FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "invalid secret")
-		case errors.Is(err, FeedErrorIncorrectSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "incorrect secret")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, err.Error())
+// eventLog returns the event log of feed feedName, creating it if needed.
+// The manager mutex must be held.
+func (m *WebSocketManager) eventLog(feedName string) *eventLog {
+	if m.eventLogs == nil {
+		m.eventLogs = map[string]*eventLog{}
+	}
+	l, ok := m.eventLogs[feedName]
+	if !ok {
+		size := m.EventLogSize
+		if size <= 0 {
+			size = DefaultEventLogSize
 		}
+		l = newEventLog(size)
+		m.eventLogs[feedName] = l
 	}
+	return l
+}
+
+// Seq returns the sequence of the last notification of feed feedName
+func (m *WebSocketManager) Seq(feedName string) uint64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if l, ok := m.eventLogs[feedName]; ok {
+		return l.seq
+	}
+	return 0
+}
+
+// Reaped returns the number of connections closed because they stopped
+// answering pings
+func (m *WebSocketManager) Reaped() int64 {
+	return m.reaped.Load()
+}
+
+// register adds c to the websockets of feed feedName and returns the
+// FeedSockets it was added to
+func (m *WebSocketManager) register(feedName string, c *subscriber) *FeedSockets {
+	m.mutex.Lock()
+	fs := m.registerLocked(feedName, c)
+	m.mutex.Unlock()
+
+	m.join(feedName, c)
+	return fs
+}
+
+// registerLocked adds c to the websockets of feed feedName. The manager
+// mutex must be held.
+func (m *WebSocketManager) registerLocked(feedName string, c *subscriber) *FeedSockets {
+	if m.feedSockets == nil {
+		m.feedSockets = map[string]*FeedSockets{}
+	}
+
+	fs, ok := m.feedSockets[feedName]
+	if !ok {
+		wsL.Logger.Debug("Adding FeedSockets", slog.Int("count_before", len(m.feedSockets)), slog.String("feedName", feedName))
+		fs = &FeedSockets{feedName: feedName}
+		m.feedSockets[feedName] = fs
+	}
+	fs.websockets = append(fs.websockets, c)
+
+	return fs
+}
+
+// unregister removes c from fs, and forgets fs if it was the last websocket
+func (m *WebSocketManager) unregister(fs *FeedSockets, c *subscriber) {
+	m.mutex.Lock()
+	removed := fs.removeConn(c)
+	feedName := fs.feedName
+	if len(fs.websockets) == 0 && m.feedSockets[fs.feedName] == fs {
+		delete(m.feedSockets, fs.feedName)
+	}
+	m.mutex.Unlock()
+
+	if removed {
+		m.leave(feedName, c)
+	}
+}
+
+// feedName returns the current name of the feed fs belongs to, which
+// changes when the feed is renamed
+func (m *WebSocketManager) feedName(fs *FeedSockets) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return fs.feedName
+}
+
+// Count returns the number of websockets and event streams connected to
+// feed feedName on all replicas. Only the current replica is counted if the
+// bus fails.
+func (m *WebSocketManager) Count(feedName string) int {
+	devices, err := m.Presence(feedName)
+	if err != nil {
+		wsL.Logger.Error("Unable to get presence", slog.String("feedName", feedName), slog.String("error", err.Error()))
+		return len(m.localDevices(feedName))
+	}
+	return len(devices)
+}
+
+// RunSocketForFeed promotes an HTTP connection to a websocket and starts
+// waiting for data. This function is blocking and typically runs from
+// a http handler, once the client has been granted access to feed f with
+// secret. Before each message, the feed is reloaded and access is checked
+// again with authorize, so that commands run on the current configuration
+// of the feed with the scopes it grants at that time.
+func (m *WebSocketManager) RunSocketForFeed(f *Feed, secret string, authorize Authorizer, w http.ResponseWriter, r *http.Request) {
+	// Upgrade http connection to websocket, the client gets an error
+	// response on failure
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		wsL.Logger.Error("Unable to upgrade WebSocket", slog.String("error", err.Error()))
+		return
+	}
+
+	conn := m.newSubscriber()
+	conn.identify(r)
+	feedSockets := m.register(f.Name(), conn)
 
 	// Cleanup
 	defer func() {
-		feedSockets.RemoveConn(c)
-		c.Close()
+		m.unregister(feedSockets, conn)
+		conn.stop(0, "")
 	}()
 
+	// load returns the feed, renamed since the websocket connected or not,
+	// with the scopes currently granted by secret
+	load := func() (*Feed, Scopes, error) {
+		return authorize(m.feedName(feedSockets), secret)
+	}
+
+	m.serve(c, conn, func() string { return m.feedName(feedSockets) }, func(data []byte) {
+		// Run JSON commands and send back their response
+		if isCommand(data) {
+			if !conn.sendJSON(m.runCommand(load, data)) {
+				m.drop(feedSockets, conn)
+			}
+			return
+		}
+
+		f, scopes, err := load()
+		if err != nil {
+			wsL.Logger.Debug("Websocket not authorized", slog.String("feedName", m.feedName(feedSockets)), slog.String("error", err.Error()))
+			return
+		}
+
+		command := strings.TrimSpace(string(data))
+		switch {
+		// Return pubic feed content
+		case command == "feed":
+			// Sequence is read first, notifications received while reading
+			// the feed may then be sent again on resume, but never missed
+			seq := m.Seq(f.Name())
+			pf, err := f.Public(scopes)
+			if err != nil {
+				wsL.Logger.Error("Unable to get feed", slog.String("feedName", f.Name()), slog.String("error", err.Error()))
+				return
+			}
+			if !conn.sendJSON(websocketFeed{PublicFeed: pf, Seq: seq}) {
+				m.drop(feedSockets, conn)
+			}
+		// Send notifications missed since a sequence
+		case strings.HasPrefix(command, "since "):
+			var seq uint64
+			if _, err := fmt.Sscanf(command, "since %d", &seq); err != nil {
+				wsL.Logger.Debug("Invalid since command", slog.String("command", command))
+				return
+			}
+			m.resume(feedSockets, conn, seq)
+		}
+	})
+}
+
+// serve writes messages queued on conn to websocket c, and passes messages
+// read from c to handle until the connection fails or stops answering
+// pings. feedName is used for logging.
+func (m *WebSocketManager) serve(c *ws.Conn, conn *subscriber, feedName func() string, handle func(data []byte)) {
+	// Clients answer pings with pongs, connections that stay silent longer
+	// than pongWait are dead
+	pongWait := durationOrDefault(m.PongWait, DefaultPongWait)
+	_ = c.SetReadDeadline(time.Now().Add(pongWait))
+	c.SetPongHandler(func(string) error {
+		return c.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	// Leave room for JSON escaping of items added with commands
+	if m.MaxItemSize > 0 {
+		c.SetReadLimit(2*m.MaxItemSize + 4096)
+	}
+
+	go m.writeWebSocket(conn, c)
+
 	// Start waiting for messages
 	for {
-		mt, message, err := c.ReadMessage()
+		mt, data, err := c.ReadMessage()
 		wsL.Logger.Debug("Message Received",
-			slog.String("message", string(message)),
+			slog.String("message", string(data)),
 			slog.Int("messageType", mt))
 		if err != nil {
-			slog.Error("Error reading message",
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				wsL.Logger.Info("Reaped dead websocket",
+					slog.String("feedName", feedName()),
+					slog.Int64("reaped", m.reaped.Add(1)))
+				return
+			}
+			wsL.Logger.Debug("Error reading message",
 				slog.String("error", err.Error()),
 				slog.Int("messageType", mt))
-			break
+			return
 		}
-		switch strings.TrimSpace(string(message)) {
-		// Return pubic feed content
-		case "feed":
-			pf, err := f.Public()
-			if err != nil {
-				utils.CloseWithCodeAndMessage(w, 500, err.Error())
-			}
-			err = c.WriteJSON(pf)
-			if err != nil {
-				utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		_ = c.SetReadDeadline(time.Now().Add(pongWait))
+
+		handle(data)
+	}
+}
+
+// resume queues notifications of fs following sequence seq on c, or a
+// resync notification when they can't be sent
+func (m *WebSocketManager) resume(fs *FeedSockets, c *subscriber, seq uint64) {
+	m.mutex.Lock()
+	slow := m.resumeLocked(fs, c, seq)
+	m.mutex.Unlock()
+
+	if slow {
+		m.drop(fs, c)
+	}
+}
+
+// resumeLocked queues notifications following seq on c, and returns true
+// if c is too slow to receive them. The manager mutex must be held.
+func (m *WebSocketManager) resumeLocked(fs *FeedSockets, c *subscriber, seq uint64) bool {
+	l := m.eventLog(fs.feedName)
+
+	// Notifications already queued on c are not sent again
+	from := seq
+	if c.lastSeq > from {
+		from = c.lastSeq
+	}
+
+	missed, ok := l.since(from)
+
+	// Notifications between seq and the first one queued are missing, or
+	// there are too many to queue
+	if c.firstSeq != 0 && seq+1 < c.firstSeq {
+		ok = false
+	}
+	if len(missed) > cap(c.send)-len(c.send) {
+		ok = false
+	}
+
+	if !ok {
+		missed = []FeedNotification{{Action: ActionResync, Seq: l.seq}}
+	}
+
+	wsL.Logger.Debug("Resuming notifications",
+		slog.String("feedName", fs.feedName),
+		slog.Uint64("since", seq),
+		slog.Bool("resync", !ok),
+		slog.Int("count", len(missed)))
+
+	for _, n := range missed {
+		b, err := c.encode(n, fs.feedName)
+		if err != nil {
+			wsL.Logger.Error("Unable to marshal notification", slog.String("error", err.Error()))
+			continue
+		}
+		if !c.enqueue(message{seq: n.Seq, data: b}) {
+			return true
+		}
+		if n.Action != ActionResync {
+			if c.firstSeq == 0 {
+				c.firstSeq = n.Seq
 			}
+			c.lastSeq = n.Seq
 		}
 	}
+
+	return false
 }
 
-// NotifyAdd notifies all connected websockets that an item has been added
-func (m *WebSocketManager) NotifyAdd(item *PublicFeedItem) error {
-	wsL.Logger.Debug("Notify websocket",
-		slog.Any("item", item),
-		slog.Int("ws count", len(m.FeedSockets)))
-	for _, f := range m.FeedSockets {
-		wsL.Logger.Debug("checking feed", slog.String("feedName", f.feedName))
-		if f.feedName == item.Feed.Name {
-			wsL.Logger.Debug("Found feed", slog.String("feedName", f.feedName))
-			for _, w := range f.websockets {
-				if err := w.WriteJSON(FeedNotification{
-					Action: "add",
-					Item:   *item,
-				}); err != nil {
-					return err
+// drop disconnects websocket c of fs which can't keep up with messages
+func (m *WebSocketManager) drop(fs *FeedSockets, c *subscriber) {
+	m.unregister(fs, c)
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	wsL.Logger.Warn("Disconnecting slow websocket", slog.String("feedName", m.feedName(fs)))
+	c.stop(ws.CloseTryAgainLater, "too slow")
+}
+
+// broadcast records notification n in the event log and queues it on all
+// websockets of feed feedName
+func (m *WebSocketManager) broadcast(feedName string, n FeedNotification) error {
+	m.mutex.Lock()
+
+	n = m.eventLog(feedName).add(n)
+	b, err := json.Marshal(n)
+	if err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	var tagged []byte
+
+	// Notifications are queued with the lock held to keep them in sequence
+	fs := m.feedSockets[feedName]
+	var count int
+	var slow []*subscriber
+	if fs != nil {
+		count = len(fs.websockets)
+		for _, c := range fs.websockets {
+			data := b
+			if c.tagged {
+				if tagged == nil {
+					tagged, _ = c.encode(n, feedName)
 				}
+				data = tagged
 			}
+			if !c.enqueue(message{seq: n.Seq, data: data}) {
+				slow = append(slow, c)
+				continue
+			}
+			if c.firstSeq == 0 {
+				c.firstSeq = n.Seq
+			}
+			c.lastSeq = n.Seq
 		}
 	}
+	m.mutex.Unlock()
+
+	wsL.Logger.Debug("Notify websocket",
+		slog.String("feedName", feedName),
+		slog.String("action", n.Action),
+		slog.Uint64("seq", n.Seq),
+		slog.Int("ws count", count))
+
+	for _, c := range slow {
+		m.drop(fs, c)
+	}
+
 	return nil
 }
 
+// NotifyAdd notifies all connected websockets that an item has been added
+func (m *WebSocketManager) NotifyAdd(item *PublicFeedItem) error {
+	return m.publish(item.Feed.Name, FeedNotification{
+		Action: "add",
+		Item:   *item,
+	})
+}
+
 // NotifyRemove notify all connected websockets that an item has been removed
 func (m *WebSocketManager) NotifyRemove(item *PublicFeedItem) error {
-	wsL.Logger.Debug("Notify websocket",
-		slog.Any("item", item),
-		slog.Int("ws count", len(m.FeedSockets)))
-	for _, f := range m.FeedSockets {
-		wsL.Logger.Debug("checking feed", slog.String("feedName", f.feedName))
-		if f.feedName == item.Feed.Name {
-			wsL.Logger.Debug("found feed", slog.String("feedName", f.feedName))
-			for _, w := range f.websockets {
-				if err := w.WriteJSON(FeedNotification{
-					Action: "remove",
-					Item:   *item,
-				}); err != nil {
-					return err
-				}
-			}
-		}
-	}
-	return nil
+	return m.publish(item.Feed.Name, FeedNotification{
+		Action: "remove",
+		Item:   *item,
+	})
 }
 
 func (m *WebSocketManager) NotifyEmpty(feed *Feed) error {
-	wsL.Logger.Debug("Notify websocket empty",
-		slog.Int("ws count", len(m.FeedSockets)))
-	for _, f := range m.FeedSockets {
-		wsL.Logger.Debug("checking feed", slog.String("feedName", f.feedName))
-		if f.feedName == feed.Name() {
-			wsL.Logger.Debug("found feed", slog.String("feedName", f.feedName))
-			for _, w := range f.websockets {
-				if err := w.WriteJSON(FeedNotification{
-					Action: "empty",
-				}); err != nil {
-					return err
-				}
-			}
-		}
+	return m.publish(feed.Name(), FeedNotification{
+		Action: "empty",
+	})
+}
+
+// RenameFeed moves websockets connected to feed oldName to newName on all
+// replicas, and notifies them with a "renamed" action holding the new name
+func (m *WebSocketManager) RenameFeed(oldName string, newName string) {
+	if err := m.publish(oldName, FeedNotification{
+		Feed:   oldName,
+		Action: ActionRenamed,
+		Name:   newName,
+	}); err != nil {
+		wsL.Logger.Error("Unable to publish rename", slog.String("feedName", oldName), slog.String("error", err.Error()))
 	}
-	return nil
+}
+
+// renameFeed moves websockets of the current process connected to feed
+// oldName to the new name of rename notification n
+func (m *WebSocketManager) renameFeed(oldName string, n FeedNotification) {
+	newName := n.Name
+
+	m.mutex.Lock()
+	// Leftover from a previous feed with the same name
+	if stale, ok := m.feedSockets[newName]; ok {
+		delete(m.feedSockets, newName)
+		closeSubscribers(newName, stale.websockets, CloseFeedDeleted, "feed deleted")
+	}
+	renamed, ok := m.feedSockets[oldName]
+	if ok {
+		delete(m.feedSockets, oldName)
+		renamed.feedName = newName
+		m.feedSockets[newName] = renamed
+	}
+	// Clients resume with the sequence of the feed
+	if l, found := m.eventLogs[newName]; found {
+		close(l.wait)
+		delete(m.eventLogs, newName)
+	}
+	if l, found := m.eventLogs[oldName]; found {
+		delete(m.eventLogs, oldName)
+		m.eventLogs[newName] = l
+	}
+	if p, found := m.pinTimers[oldName]; found {
+		delete(m.pinTimers, oldName)
+		p.feedName = newName
+		m.pinTimers[newName] = p
+	}
+	m.mutex.Unlock()
+
+	// The notification is recorded even without websockets, the sequence
+	// of the feed continues under its new name
+	if err := m.broadcast(newName, n); err != nil {
+		wsL.Logger.Error("Unable to notify websocket", slog.String("feedName", newName), slog.String("error", err.Error()))
+	}
+}
+
+// CloseFeed closes all websockets connected to feed feedName with code and
+// reason on all replicas, and forgets about the feed
+func (m *WebSocketManager) CloseFeed(feedName string, code int, reason string) {
+	if err := m.publish(feedName, FeedNotification{
+		Action: ActionClosed,
+		Code:   code,
+		Reason: reason,
+	}); err != nil {
+		wsL.Logger.Error("Unable to publish close", slog.String("feedName", feedName), slog.String("error", err.Error()))
+	}
+}
+
+// closeFeed closes websockets of the current process connected to feed
+// feedName
+func (m *WebSocketManager) closeFeed(feedName string, code int, reason string) {
+	m.mutex.Lock()
+	var conns []*subscriber
+	if fs, ok := m.feedSockets[feedName]; ok {
+		delete(m.feedSockets, feedName)
+		conns = append(conns, fs.websockets...)
+	}
+	// Pending polls return
+	if l, ok := m.eventLogs[feedName]; ok {
+		close(l.wait)
+		delete(m.eventLogs, feedName)
+	}
+	if p, ok := m.pinTimers[feedName]; ok {
+		p.timer.Stop()
+		delete(m.pinTimers, feedName)
+	}
+	m.mutex.Unlock()
+
+	closeSubscribers(feedName, conns, code, reason)
 }
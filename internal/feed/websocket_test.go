@@ -0,0 +1,342 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// authorizeSecret returns an Authorizer granting the scopes of a secret on
+// feeds of fm
+func authorizeSecret(fm *FeedManager) Authorizer {
+	return func(feedName string, secret string) (*Feed, Scopes, error) {
+		f, err := fm.GetFeedWithScope(feedName, secret, "", ScopeRead)
+		if err != nil {
+			code := http.StatusUnauthorized
+			if errors.Is(err, FeedErrorNotFound) {
+				code = http.StatusNotFound
+			}
+			return nil, nil, &CommandError{Code: code, Message: err.Error()}
+		}
+		scopes, _ := f.ScopesFor(secret, "")
+		return f, scopes, nil
+	}
+}
+
+// newWebSocketServer returns a feed and a server running websockets for it,
+// connected with a read only token
+func newWebSocketServer(t *testing.T) (*WebSocketManager, *Feed, *httptest.Server) {
+	m := NewWebSocketManager(nil)
+	fm := NewFeedManager(t.TempDir(), m)
+	m.FeedManager = fm
+
+	if _, err := fm.CreateFeed("websocket", FeedOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fm.GetFeed("websocket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := f.Config.AddToken("websocket", Scopes{ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.RunSocketForFeed(f, token.Token, authorizeSecret(fm), w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return m, f, server
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server) *ws.Conn {
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// waitForCount waits until count websockets are connected to feedName
+func waitForCount(t *testing.T, m *WebSocketManager, feedName string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Count(feedName) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expect %d websockets but got %d", count, m.Count(feedName))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWebSocketConcurrentNotify(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+
+	const clients = 5
+	const writers = 4
+	const items = 10
+
+	conns := []*ws.Conn{}
+	for i := 0; i < clients; i++ {
+		c := dialWebSocket(t, server)
+		defer c.Close()
+		conns = append(conns, c)
+	}
+	waitForCount(t, m, f.Name(), clients)
+
+	wg := sync.WaitGroup{}
+
+	// Clients connecting and disconnecting while items are added
+	stop := make(chan struct{})
+	churn := sync.WaitGroup{}
+	churn.Add(1)
+	go func() {
+		defer churn.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < items; j++ {
+				name := fmt.Sprintf("item-%d-%d.bin", i, j)
+				if err := f.AddItem("application/octet-stream", name, strings.NewReader("data")); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+
+	received := make([]int, clients)
+	for i, c := range conns {
+		wg.Add(1)
+		go func(i int, c *ws.Conn) {
+			defer wg.Done()
+			_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for received[i] < writers*items {
+				var n FeedNotification
+				if err := c.ReadJSON(&n); err != nil {
+					t.Error(err)
+					return
+				}
+				if n.Action == "add" {
+					received[i]++
+				}
+			}
+		}(i, c)
+	}
+
+	wg.Wait()
+	close(stop)
+	churn.Wait()
+
+	for i, r := range received {
+		if r != writers*items {
+			t.Errorf("Expect client %d to receive %d notifications but got %d", i, writers*items, r)
+		}
+	}
+}
+
+func TestWebSocketSlowClient(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+	m.SendBufferSize = 1
+
+	fast := dialWebSocket(t, server)
+	defer fast.Close()
+	waitForCount(t, m, f.Name(), 1)
+
+	// A client whose messages are never written, counted by its device
+	slow := m.newSubscriber()
+	slow.device = &Device{ID: "slow", Connected: time.Now()}
+	m.register(f.Name(), slow)
+	waitForCount(t, m, f.Name(), 2)
+
+	for i := 0; i < 3; i++ {
+		if err := f.AddItem("application/octet-stream", fmt.Sprintf("item%d.bin", i), strings.NewReader("data")); err != nil {
+			t.Fatal(err)
+		}
+		// Let the fast client writer catch up
+		_ = fast.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var n FeedNotification
+		if err := fast.ReadJSON(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n.Action != "add" {
+			t.Errorf("Expect add action but got %s", n.Action)
+		}
+	}
+
+	select {
+	case <-slow.done:
+	default:
+		t.Fatal("Expect slow client to be disconnected")
+	}
+	if slow.closeCode != ws.CloseTryAgainLater {
+		t.Errorf("Expect close code %d but got %d", ws.CloseTryAgainLater, slow.closeCode)
+	}
+	waitForCount(t, m, f.Name(), 1)
+}
+
+func TestWebSocketCloseFeed(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+
+	c := dialWebSocket(t, server)
+	defer c.Close()
+	waitForCount(t, m, f.Name(), 1)
+
+	m.CloseFeed(f.Name(), CloseFeedDeleted, "feed deleted")
+
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := c.ReadMessage()
+	if !ws.IsCloseError(err, CloseFeedDeleted) {
+		t.Errorf("Expect close code %d but got %v", CloseFeedDeleted, err)
+	}
+	waitForCount(t, m, f.Name(), 0)
+}
+
+func TestWebSocketHeartbeat(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+	m.PingInterval = 20 * time.Millisecond
+	m.PongWait = 100 * time.Millisecond
+
+	// Reading answers pings with pongs
+	alive := dialWebSocket(t, server)
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// A client that never reads doesn't answer pings
+	dead := dialWebSocket(t, server)
+	defer dead.Close()
+
+	waitForCount(t, m, f.Name(), 2)
+	waitForCount(t, m, f.Name(), 1)
+
+	if m.Reaped() != 1 {
+		t.Errorf("Expect 1 reaped connection but got %d", m.Reaped())
+	}
+
+	// The live client is kept well after pong wait
+	time.Sleep(300 * time.Millisecond)
+	if m.Count(f.Name()) != 1 {
+		t.Errorf("Expect live websocket to be kept, got %d", m.Count(f.Name()))
+	}
+}
+
+func TestWebSocketResume(t *testing.T) {
+	m, f, server := newWebSocketServer(t)
+	m.EventLogSize = 4
+
+	addItems := func(count int) {
+		for i := 0; i < count; i++ {
+			if err := f.AddItem("text/plain", "", strings.NewReader("data")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	read := func(c *ws.Conn) FeedNotification {
+		t.Helper()
+		_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var n FeedNotification
+		if err := c.ReadJSON(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	c := dialWebSocket(t, server)
+	waitForCount(t, m, f.Name(), 1)
+
+	addItems(2)
+	if n := read(c); n.Seq != 1 {
+		t.Errorf("Expect sequence 1 but got %d", n.Seq)
+	}
+	if n := read(c); n.Seq != 2 {
+		t.Errorf("Expect sequence 2 but got %d", n.Seq)
+	}
+
+	// Events happening while disconnected are sent on resume
+	c.Close()
+	waitForCount(t, m, f.Name(), 0)
+	addItems(2)
+
+	c = dialWebSocket(t, server)
+	defer c.Close()
+	if err := c.WriteMessage(ws.TextMessage, []byte("since 2")); err != nil {
+		t.Fatal(err)
+	}
+	for _, seq := range []uint64{3, 4} {
+		if n := read(c); n.Action != "add" || n.Seq != seq {
+			t.Errorf("Expect add with sequence %d but got %+v", seq, n)
+		}
+	}
+
+	// Live notifications follow
+	addItems(1)
+	if n := read(c); n.Seq != 5 {
+		t.Errorf("Expect sequence 5 but got %d", n.Seq)
+	}
+
+	// Resuming from a sequence not in the log anymore requires a resync
+	c2 := dialWebSocket(t, server)
+	defer c2.Close()
+	if err := c2.WriteMessage(ws.TextMessage, []byte("since 0")); err != nil {
+		t.Fatal(err)
+	}
+	if n := read(c2); n.Action != ActionResync || n.Seq != 5 {
+		t.Errorf("Expect resync to sequence 5 but got %+v", n)
+	}
+
+	// The feed includes the sequence it is up to date with
+	if err := c2.WriteMessage(ws.TextMessage, []byte("feed")); err != nil {
+		t.Fatal(err)
+	}
+	_ = c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var wf struct {
+		Name string `json:"name"`
+		Seq  uint64 `json:"seq"`
+	}
+	if err := c2.ReadJSON(&wf); err != nil {
+		t.Fatal(err)
+	}
+	if wf.Name != f.Name() || wf.Seq != 5 {
+		t.Errorf("Expect feed at sequence 5 but got %+v", wf)
+	}
+
+	// A sequence from before a server restart is unknown
+	c3 := dialWebSocket(t, server)
+	defer c3.Close()
+	if err := c3.WriteMessage(ws.TextMessage, []byte("since 42")); err != nil {
+		t.Fatal(err)
+	}
+	if n := read(c3); n.Action != ActionResync {
+		t.Errorf("Expect resync but got %+v", n)
+	}
+}
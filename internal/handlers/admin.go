@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/ybizeul/ybfeed/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// adminAuth is a middleware restricting access to the server administration
+// API to clients providing the admin token as a bearer token. The admin API
+// is disabled when no admin token is configured.
+func (api *ApiHandler) adminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.Config.AdminToken == "" {
+			utils.CloseWithCodeAndMessage(w, 404, "Admin API is disabled")
+			return
+		}
+
+		if !api.isAdminRequest(r) {
+			hL.Logger.Warn("Unauthorized admin API request", slog.String("request_uri", r.RequestURI), slog.String("remote_addr", r.RemoteAddr))
+			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdminRequest returns true if r carries the server admin token
+func (api *ApiHandler) isAdminRequest(r *http.Request) bool {
+	if api.Config.AdminToken == "" {
+		return false
+	}
+
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(api.Config.AdminToken)) == 1
+}
+
+func (api *ApiHandler) adminSecretsGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Admin API secrets request", slog.String("request_uri", r.RequestURI))
+
+	secrets, err := api.FeedManager.Secrets()
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccessJSON(w, secrets)
+}
+
+func (api *ApiHandler) adminFeedsGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Admin API feeds request", slog.String("request_uri", r.RequestURI))
+
+	stats, err := api.FeedManager.Stats()
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccessJSON(w, stats)
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"time"
 
 	ws "github.com/gorilla/websocket"
@@ -19,6 +21,7 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/ybizeul/ybfeed/internal/feed"
+	"github.com/ybizeul/ybfeed/internal/users"
 	"github.com/ybizeul/ybfeed/internal/utils"
 	"github.com/ybizeul/ybfeed/pkg/yblog"
 
@@ -27,6 +30,9 @@ import (
 
 var hL = yblog.NewYBLogger("http", []string{"DEBUG", "DEBUG_HTTP"})
 
+// retentionInterval is the interval between removals of expired items
+const retentionInterval = time.Minute
+
 var webUiHandler = http.FileServer(http.FS(ui.GetUiFs()))
 
 // RootHandlerFunc figures out how to handle incoming HTTP requests.
@@ -81,12 +87,32 @@ type ApiHandler struct {
 	Config           APIConfig
 	HttpPort         int
 	ListenAddr       string
+	Cookie           CookieSettings
+	AllowedOrigins   []string
 	WebSocketManager *feed.WebSocketManager
 	FeedManager      *feed.FeedManager
+	UserManager      *users.UserManager
+	SessionManager   *users.SessionManager
+
+	// TrustedProxies are the networks of reverse proxies allowed to set the
+	// X-Forwarded-Host header
+	TrustedProxies []*net.IPNet
+
+	// AnonymousFeeds allows anonymous users to create feeds, otherwise
+	// only authenticated users can
+	AnonymousFeeds bool
+
+	// ImplicitFeeds creates unknown feeds when they are requested, otherwise
+	// feeds have to be created explicitly with POST /api/feeds
+	ImplicitFeeds bool
+
+	oidc *oidcProvider
 }
 
 type APIConfig struct {
 	NotificationSettings *feed.NotificationSettings `json:"notification,omitempty"`
+	SigningKey           string                     `json:"signingkey,omitempty"`
+	AdminToken           string                     `json:"admintoken,omitempty"`
 }
 
 func APIConfigFromFile(p string) (*APIConfig, error) {
@@ -127,15 +153,26 @@ func NewApiHandler(basePath string) (*ApiHandler, error) {
 		}
 	}
 
-	ws := feed.WebSocketManager{}
+	if config.SigningKey == "" {
+		config.SigningKey, err = generateSigningKey()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	fm := feed.NewFeedManager(basePath, &ws)
+	ws := feed.NewWebSocketManager(nil)
+
+	fm := feed.NewFeedManager(basePath, ws)
 	fm.NotificationSettings = config.NotificationSettings
 	result := &ApiHandler{
 		BasePath:         basePath,
 		Config:           *config,
+		Cookie:           DefaultCookieSettings(),
 		FeedManager:      fm,
-		WebSocketManager: &ws,
+		UserManager:      users.NewUserManager(path.Join(basePath, "users.json")),
+		SessionManager:   users.NewSessionManager(path.Join(basePath, "sessions.json")),
+		WebSocketManager: ws,
+		ImplicitFeeds:    true,
 	}
 
 	ws.FeedManager = result.FeedManager
@@ -159,6 +196,8 @@ func (api *ApiHandler) WriteConfig() error {
 	return nil
 }
 func (api *ApiHandler) StartServer() {
+	go api.FeedManager.RunRetention(retentionInterval)
+
 	r := api.GetServer()
 	err := http.ListenAndServe(fmt.Sprintf("%s:%d", api.ListenAddr, api.HttpPort), r)
 	if err != nil {
@@ -180,6 +219,9 @@ func (api *ApiHandler) GetServer() *chi.Mux {
 		})
 	})
 
+	r.Use(api.checkOrigin)
+
+	r.Get("/ws", api.wsHandler)
 	r.Mount("/ws/{feedName}", http.HandlerFunc(api.feedWSHandler))
 
 	r.Get("/api", func(w http.ResponseWriter, r *http.Request) {
@@ -188,18 +230,58 @@ func (api *ApiHandler) GetServer() *chi.Mux {
 		}
 	})
 
-	r.Post("/api/secrets", api.postSecretsHandler)
+	if api.oidc != nil {
+		r.Get("/auth/login", api.oidcLoginFunc)
+		r.Get("/auth/callback", api.oidcCallbackFunc)
+	}
+	r.Post("/auth/logout", api.logoutPostFunc)
+	r.Post("/api/login", api.loginPostFunc)
+	r.Get("/api/me", api.meGetFunc)
+	r.Get("/api/me/feeds", api.meFeedsGetFunc)
+	r.Post("/api/me/password", api.mePasswordPostFunc)
+
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(api.adminAuth)
+		r.Get("/secrets", api.adminSecretsGetFunc)
+		r.Get("/feeds", api.adminFeedsGetFunc)
+		r.Get("/users", api.adminUsersGetFunc)
+		r.Post("/users", api.adminUsersPostFunc)
+		r.Delete("/users/{userName}", api.adminUserDeleteFunc)
+		r.Delete("/sessions/{userName}", api.adminSessionsDeleteFunc)
+	})
 	r.Route("/api/feeds", func(r chi.Router) {
-		r.Get("/{feedName}", api.feedGetFunc)
-		r.Post("/{feedName}", api.feedPostFunc)
-		r.Patch("/{feedName}", api.feedPatchFunc)
-		r.Post("/{feedName}/subscription", api.subscriptionPostFunc)
-		r.Delete("/{feedName}/subscription", api.subscriptionDeleteFunc)
-		r.Delete("/{feedName}/items", api.itemsDeleteFunc)
-		r.Get("/{feedName}/items/{itemName}", api.itemGetFunc)
-		r.Delete("/{feedName}/items/{itemName}", api.itemDeleteFunc)
+		r.Post("/", api.feedsPostFunc)
+		// Browsers send the secret cookie of a feed with websockets opened
+		// under its path. Aliases are resolved by the handler as websockets
+		// don't follow redirects.
+		r.Get("/{feedName}/ws", api.feedWSHandler)
+		r.Route("/{feedName}", func(r chi.Router) {
+			r.Use(api.feedAlias)
+			r.Get("/", api.feedGetFunc)
+			r.Post("/", api.feedPostFunc)
+			r.Patch("/", api.feedPatchFunc)
+			r.Patch("/settings", api.feedSettingsPatchFunc)
+			r.Delete("/", api.feedDeleteFunc)
+			r.Post("/rename", api.feedRenamePostFunc)
+			r.Get("/events", api.feedEventsGetFunc)
+			r.Get("/poll", api.feedPollGetFunc)
+			r.Get("/presence", api.feedPresenceGetFunc)
+			r.Post("/subscription", api.subscriptionPostFunc)
+			r.Delete("/subscription", api.subscriptionDeleteFunc)
+			r.Post("/owner", api.feedOwnerPostFunc)
+			r.Get("/members", api.membersGetFunc)
+			r.Put("/members/{userName}", api.memberPutFunc)
+			r.Delete("/members/{userName}", api.memberDeleteFunc)
+			r.Get("/tokens", api.tokensGetFunc)
+			r.Post("/tokens", api.tokensPostFunc)
+			r.Delete("/tokens/{token}", api.tokenDeleteFunc)
+			r.Delete("/items", api.itemsDeleteFunc)
+			r.Get("/items/{itemName}", api.itemGetFunc)
+			r.Delete("/items/{itemName}", api.itemDeleteFunc)
+			r.Post("/items/{itemName}/link", api.itemLinkPostFunc)
+		})
 	})
-	r.Get("/*", RootHandlerFunc)
+	r.With(api.uiAlias).Get("/*", RootHandlerFunc)
 
 	slog.Info("ybFeed starting",
 		slog.String("version", api.Version),
@@ -222,29 +304,145 @@ func (api *ApiHandler) feedWSHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	authorize := api.socketAuthorizer(api.sessionUser(r))
+
+	f, _, err := authorize(feedName, secret)
 
 	if err != nil {
 		// A web socket doesn't have a standard http status code, so we need
 		// to open it and close it with a relevant code
 		var upgrader = ws.Upgrader{}
-		c, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
+		c, uerr := upgrader.Upgrade(w, r, nil)
+		if uerr != nil {
 			return
 		}
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			_ = c.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(http.StatusNotFound+4000, ""), time.Now().Add(time.Second))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			_ = c.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(http.StatusUnauthorized+4000, ""), time.Now().Add(time.Second))
-		default:
-			_ = c.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(http.StatusInternalServerError+4000, ""), time.Now().Add(time.Second))
+		var cerr *feed.CommandError
+		code := http.StatusInternalServerError
+		if errors.As(err, &cerr) {
+			code = cerr.Code
 		}
+		_ = c.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(code+4000, ""), time.Now().Add(time.Second))
 		c.Close()
 		return
 	}
 
-	api.WebSocketManager.RunSocketForFeed(feedName, w, r)
+	api.WebSocketManager.RunSocketForFeed(f, secret, authorize, w, r)
+}
+
+// wsHandler runs a websocket subscribing to several feeds, authenticated
+// with their own secret or the session user
+func (api *ApiHandler) wsHandler(w http.ResponseWriter, r *http.Request) {
+	api.WebSocketManager.RunSocket(api.socketAuthorizer(api.sessionUser(r)), w, r)
+}
+
+// socketAuthorizer returns a feed.Authorizer loading feeds for websockets,
+// authenticated with a secret or the session user. Errors are
+// *feed.CommandError with the HTTP status code of the failure.
+func (api *ApiHandler) socketAuthorizer(user string) feed.Authorizer {
+	return func(feedName string, secret string) (*feed.Feed, feed.Scopes, error) {
+		// Websockets don't follow redirects, renamed feeds are resolved here
+		if target, ok := api.FeedManager.Alias(feedName); ok {
+			feedName = target
+		}
+		f, err := api.FeedManager.GetFeedWithScope(feedName, secret, user, feed.ScopeRead)
+		if err != nil {
+			return nil, nil, &feed.CommandError{Code: feedErrorStatus(err), Message: err.Error()}
+		}
+		scopes, _ := f.ScopesFor(secret, user)
+		return f, scopes, nil
+	}
+}
+
+// feedPresenceGetFunc returns the devices connected to a feed
+func (api *ApiHandler) feedPresenceGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed presence request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	devices, err := api.WebSocketManager.Presence(f.Name())
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccessJSON(w, devices)
+}
+
+// feedEventsGetFunc streams feed notifications as server-sent events
+func (api *ApiHandler) feedEventsGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed events request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	api.WebSocketManager.RunEventStreamForFeed(f, w, r)
+}
+
+// feedPollGetFunc returns feed notifications following the since query
+// parameter, waiting for one until timeout
+func (api *ApiHandler) feedPollGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed poll request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	var since *uint64
+	if s := r.URL.Query().Get("since"); s != "" {
+		seq, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			utils.CloseWithCodeAndMessage(w, 400, "since should be a sequence number")
+			return
+		}
+		since = &seq
+	}
+
+	timeout := feed.DefaultPollTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil || timeout < 0 || timeout > feed.MaxPollTimeout {
+			utils.CloseWithCodeAndMessage(w, 400, fmt.Sprintf("timeout should be a duration up to %s", feed.MaxPollTimeout))
+			return
+		}
+	}
+
+	WriteSuccessJSON(w, api.WebSocketManager.Poll(r.Context(), f.Name(), since, timeout))
 }
 
 func (api *ApiHandler) feedGetFunc(w http.ResponseWriter, r *http.Request) {
@@ -260,47 +458,54 @@ func (api *ApiHandler) feedGetFunc(w http.ResponseWriter, r *http.Request) {
 	var f *feed.Feed
 	var err error
 
+	secret, _ := utils.GetSecret(r)
+	user := api.sessionUser(r)
+	scopes := feed.Scopes{feed.ScopeAdmin}
+
 	f, err = api.FeedManager.GetFeed(feedName)
 
 	if err != nil {
 		if errors.Is(err, feed.FeedErrorNotFound) {
-			_, err = feed.NewFeed(path.Join(api.BasePath, feedName))
+			if !api.ImplicitFeeds {
+				writeFeedError(w, feedName, err)
+				return
+			}
+			if user == "" && !api.AnonymousFeeds {
+				utils.CloseWithCodeAndMessage(w, 401, "Authentication required to create a feed")
+				return
+			}
+			// Feeds created by authenticated users belong to them
+			f, err = api.FeedManager.CreateFeed(feedName, feed.FeedOptions{Owner: user})
 			if err != nil {
-				utils.CloseWithCodeAndMessage(w, 500, err.Error())
+				writeFeedError(w, feedName, err)
+				return
 			}
-			f, _ = api.FeedManager.GetFeed(feedName)
+			secret = f.Config.Secret
 		} else {
-			utils.CloseWithCodeAndMessage(w, 500, err.Error())
+			writeFeedError(w, feedName, err)
 			return
 		}
 	} else {
-		secret, _ := utils.GetSecret(r)
-		hL.Logger.Debug("secret", slog.String("secret", secret))
-
-		err = f.IsSecretValid(secret)
+		scopes, err = f.ScopesFor(secret, user)
 		if err != nil {
-			switch {
-			case errors.Is(err, feed.FeedErrorInvalidSecret) || errors.Is(err, feed.FeedConfigErrorPinExpired):
-				utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-			default:
-				utils.CloseWithCodeAndMessage(w, 500, err.Error())
-			}
+			writeFeedError(w, feedName, err)
 			return
 		}
 	}
 
-	publicFeed, err := f.Public()
+	publicFeed, err := f.Public(scopes)
 	if err != nil {
 		utils.CloseWithCodeAndMessage(w, 500, err.Error())
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "Secret",
-		Value:   publicFeed.Secret,
-		Path:    fmt.Sprintf("/api/feeds/%s", feedName),
-		Expires: time.Now().Add(time.Hour * 24 * 365 * 10),
-	})
+	// The cookie holds the feed secret for administrators, so a PIN is
+	// traded for the secret, or the token that has been used otherwise
+	if publicFeed.Secret != "" {
+		secret = publicFeed.Secret
+	}
+
+	http.SetCookie(w, api.secretCookie(r, feedName, secret))
 
 	j, err := json.Marshal(publicFeed)
 	if err != nil {
@@ -312,6 +517,141 @@ func (api *ApiHandler) feedGetFunc(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// feedDeleteFunc removes a feed and everything it contains. It is authorized
+// by the admin scope on the feed or the server admin token.
+func (api *ApiHandler) feedDeleteFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed API delete request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	var f *feed.Feed
+	var err error
+	if api.isAdminRequest(r) {
+		f, err = api.FeedManager.GetFeed(feedName)
+	} else {
+		f, err = api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+	}
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+	feedName = f.Name()
+
+	if err = api.FeedManager.DeleteFeed(feedName); err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	http.SetCookie(w, api.newCookie(r, "Secret", "", secretCookiePath(feedName), -1))
+
+	WriteSuccess(w, fmt.Sprintf("Feed %s deleted", feedName))
+}
+
+// FeedRequest is the body expected to create a feed
+type FeedRequest struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Retention   feed.Duration `json:"retention"`
+}
+
+// feedsPostFunc creates a new feed and returns it with its secret
+func (api *ApiHandler) feedsPostFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed creation request", slog.String("request_uri", r.RequestURI))
+
+	user := api.sessionUser(r)
+	if user == "" && !api.AnonymousFeeds {
+		utils.CloseWithCodeAndMessage(w, 401, "Authentication required to create a feed")
+		return
+	}
+
+	var fr FeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&fr); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, fmt.Sprintf("Unable to parse feed request: %s", err.Error()))
+		return
+	}
+
+	if fr.Name == "" {
+		utils.CloseWithCodeAndMessage(w, 400, "Missing feed name")
+		return
+	}
+
+	f, err := api.FeedManager.CreateFeed(fr.Name, feed.FeedOptions{
+		Description: fr.Description,
+		Retention:   fr.Retention,
+		Owner:       user,
+	})
+	if err != nil {
+		writeFeedError(w, fr.Name, err)
+		return
+	}
+
+	publicFeed, err := f.Public(feed.Scopes{feed.ScopeAdmin})
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	http.SetCookie(w, api.secretCookie(r, fr.Name, f.Config.Secret))
+
+	w.WriteHeader(http.StatusCreated)
+	WriteSuccessJSON(w, publicFeed)
+}
+
+// FeedSettingsRequest is the body expected to update feed settings, omitted
+// settings are left unchanged
+type FeedSettingsRequest struct {
+	Description *string        `json:"description"`
+	Retention   *feed.Duration `json:"retention"`
+}
+
+// feedSettingsPatchFunc updates the description and retention of a feed
+func (api *ApiHandler) feedSettingsPatchFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed settings request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	var sr FeedSettingsRequest
+	if err = json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, fmt.Sprintf("Unable to parse settings request: %s", err.Error()))
+		return
+	}
+
+	description, retention := f.Config.Description, f.Config.Retention
+	if sr.Description != nil {
+		description = *sr.Description
+	}
+	if sr.Retention != nil {
+		retention = *sr.Retention
+	}
+
+	if err = f.SetSettings(description, retention); err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	WriteSuccessJSON(w, f.Settings())
+}
+
 func (api *ApiHandler) feedPatchFunc(w http.ResponseWriter, r *http.Request) {
 	hL.Logger.Debug("Feed API Set PIN request", slog.String("request_uri", r.RequestURI))
 	secret, _ := utils.GetSecret(r)
@@ -319,19 +659,13 @@ func (api *ApiHandler) feedPatchFunc(w http.ResponseWriter, r *http.Request) {
 	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
 	if feedName == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+		writeFeedError(w, feedName, err)
 		return
 	}
 
@@ -347,6 +681,7 @@ func (api *ApiHandler) feedPatchFunc(w http.ResponseWriter, r *http.Request) {
 	if err = f.SetPIN(string(pin)); err != nil {
 		if errors.Is(err, feed.FeedConfigErrorPinIncorrectLength) {
 			utils.CloseWithCodeAndMessage(w, 400, "PIN should be 4 digits")
+			return
 		}
 		utils.CloseWithCodeAndMessage(w, 500, err.Error())
 		return
@@ -360,18 +695,12 @@ func (api *ApiHandler) itemsDeleteFunc(w http.ResponseWriter, r *http.Request) {
 	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
 	if feedName == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeDelete)
 	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+		writeFeedError(w, feedName, err)
 		return
 	}
 
@@ -393,25 +722,37 @@ func (api *ApiHandler) itemGetFunc(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	feedItem, _ := url.QueryUnescape(chi.URLParam(r, "itemName"))
 
-	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+	if feedItem == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed item")
 		return
 	}
 
-	feedItem, _ := url.QueryUnescape(chi.URLParam(r, "itemName"))
+	var f *feed.Feed
+	var err error
 
-	if feedItem == "" {
-		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed item")
+	// Signed links give access to a single item without the feed secret
+	if signature := r.URL.Query().Get("signature"); signature != "" {
+		f, err = api.FeedManager.GetFeed(feedName)
+		if err == nil {
+			err = api.verifyItemSignature(f, feedItem, r.URL.Query().Get("expires"), signature)
+		} else {
+			err = LinkErrorInvalidSignature
+		}
+		if err != nil {
+			utils.CloseWithCodeAndMessage(w, 403, err.Error())
+			return
+		}
+	} else {
+		f, err = api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
+	}
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
 	}
+
 	content, err := f.GetItemData(feedItem)
 
 	if err != nil {
@@ -436,19 +777,13 @@ func (api *ApiHandler) feedPostFunc(w http.ResponseWriter, r *http.Request) {
 	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
 	if feedName == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeWrite)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+		writeFeedError(w, feedName, err)
 		return
 	}
 
@@ -493,25 +828,20 @@ func (api *ApiHandler) itemDeleteFunc(w http.ResponseWriter, r *http.Request) {
 	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
 	if feedName == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeDelete)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+		writeFeedError(w, feedName, err)
 		return
 	}
 
 	feedItem, _ := url.QueryUnescape(chi.URLParam(r, "itemName"))
 	if feedItem == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed item")
+		return
 	}
 
 	err = f.RemoveItem(feedItem, true)
@@ -539,19 +869,13 @@ func (api *ApiHandler) subscriptionPostFunc(w http.ResponseWriter, r *http.Reque
 	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
 	if feedName == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+		writeFeedError(w, feedName, err)
 		return
 	}
 
@@ -564,7 +888,7 @@ func (api *ApiHandler) subscriptionPostFunc(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = f.Config.AddSubscription(s)
+	err = f.AddSubscription(s)
 
 	if err != nil {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to add subscription")
@@ -581,19 +905,13 @@ func (api *ApiHandler) subscriptionDeleteFunc(w http.ResponseWriter, r *http.Req
 	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
 	if feedName == "" {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
 	}
 
-	f, err := api.FeedManager.GetFeedWithAuth(feedName, secret)
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
 
 	if err != nil {
-		switch {
-		case errors.Is(err, feed.FeedErrorNotFound):
-			utils.CloseWithCodeAndMessage(w, 404, fmt.Sprintf("feed '%s' not found", feedName))
-		case errors.Is(err, feed.FeedErrorInvalidSecret):
-			utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
-		default:
-			utils.CloseWithCodeAndMessage(w, 500, fmt.Sprintf("Error while getting feed: %s", err.Error()))
-		}
+		writeFeedError(w, feedName, err)
 		return
 	}
 
@@ -615,7 +933,7 @@ func (api *ApiHandler) subscriptionDeleteFunc(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = f.Config.DeleteSubscription(s)
+	err = f.DeleteSubscription(s)
 
 	if err != nil {
 		utils.CloseWithCodeAndMessage(w, 500, "Unable to add subscription")
@@ -623,6 +941,199 @@ func (api *ApiHandler) subscriptionDeleteFunc(w http.ResponseWriter, r *http.Req
 	}
 }
 
-func (api *ApiHandler) postSecretsHandler(w http.ResponseWriter, r *http.Request) {
-	api.FeedManager.DumpSecrets()
+// OwnerRequest is the optional body of a feed ownership transfer
+type OwnerRequest struct {
+	User string `json:"user"`
+}
+
+// feedOwnerPostFunc assigns an unowned feed to the authenticated user, or
+// transfers a feed owned by the authenticated user to the user in the request
+func (api *ApiHandler) feedOwnerPostFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed claim request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	user := api.sessionUser(r)
+	if user == "" {
+		utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, user, feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	// The current owner can transfer the feed to another user
+	var or OwnerRequest
+	if r.ContentLength != 0 {
+		if err = json.NewDecoder(r.Body).Decode(&or); err != nil {
+			utils.CloseWithCodeAndMessage(w, 400, fmt.Sprintf("Unable to parse owner request: %s", err.Error()))
+			return
+		}
+	}
+	owner := user
+	if or.User != "" {
+		owner = or.User
+	}
+
+	if err = f.Config.TransferOwner(user, owner); err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	WriteSuccess(w, fmt.Sprintf("Feed %s is now owned by %s", feedName, owner))
+}
+
+func (api *ApiHandler) tokensGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed tokens request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	tokens := f.Config.Tokens
+	if tokens == nil {
+		tokens = []feed.Token{}
+	}
+
+	WriteSuccessJSON(w, tokens)
+}
+
+// TokenRequest is the body expected when creating a new feed token
+type TokenRequest struct {
+	Name   string      `json:"name"`
+	Scopes feed.Scopes `json:"scopes"`
+}
+
+func (api *ApiHandler) tokensPostFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed token creation request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	var tr TokenRequest
+
+	err = json.NewDecoder(r.Body).Decode(&tr)
+
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to parse token request")
+		return
+	}
+
+	token, err := f.Config.AddToken(tr.Name, tr.Scopes)
+
+	if err != nil {
+		if errors.Is(err, feed.FeedErrorInvalidScope) {
+			utils.CloseWithCodeAndMessage(w, 400, err.Error())
+			return
+		}
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to add token")
+		return
+	}
+
+	WriteSuccessJSON(w, token)
+}
+
+func (api *ApiHandler) tokenDeleteFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed token deletion request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	token, _ := url.QueryUnescape(chi.URLParam(r, "token"))
+
+	err = f.Config.DeleteToken(token)
+
+	if err != nil {
+		if errors.Is(err, feed.FeedErrorTokenNotFound) {
+			utils.CloseWithCodeAndMessage(w, 404, "Token does not exists")
+			return
+		}
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to delete token")
+		return
+	}
+}
+
+// feedErrorStatus returns the HTTP status code matching an error returned
+// while getting a feed
+func feedErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, feed.FeedErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, feed.FeedErrorInvalidSecret),
+		errors.Is(err, feed.FeedErrorIncorrectSecret),
+		errors.Is(err, feed.FeedConfigErrorPinIncorrect),
+		errors.Is(err, feed.FeedConfigErrorPinExpired):
+		return http.StatusUnauthorized
+	case errors.Is(err, feed.FeedErrorInsufficientScope):
+		return http.StatusForbidden
+	case errors.Is(err, feed.FeedErrorAlreadyExists),
+		errors.Is(err, feed.FeedErrorAlreadyOwned):
+		return http.StatusConflict
+	case errors.Is(err, feed.FeedConfigErrorInvalidRetention),
+		errors.Is(err, feed.FeedErrorInvalidName):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeFeedError closes the request with the HTTP status matching err
+func writeFeedError(w http.ResponseWriter, feedName string, err error) {
+	switch code := feedErrorStatus(err); code {
+	case http.StatusNotFound:
+		utils.CloseWithCodeAndMessage(w, code, fmt.Sprintf("feed '%s' not found", feedName))
+	case http.StatusUnauthorized:
+		utils.CloseWithCodeAndMessage(w, code, "Unauthorized")
+	case http.StatusForbidden:
+		utils.CloseWithCodeAndMessage(w, code, "Forbidden")
+	case http.StatusBadRequest, http.StatusConflict:
+		utils.CloseWithCodeAndMessage(w, code, err.Error())
+	default:
+		utils.CloseWithCodeAndMessage(w, code, fmt.Sprintf("Error while getting feed: %s", err.Error()))
+	}
 }
@@ -1,34 +1,89 @@
 package handlers
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
 	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Appboy/webpush-go"
 	"github.com/davecgh/go-spew/spew"
+	ws "github.com/gorilla/websocket"
 	"github.com/ybizeul/ybfeed/internal/feed"
 )
 
-const baseDir = "../../test/"
+// fixturesDir holds the test data, copied to baseDir before running tests so
+// that they never modify tracked files
+const fixturesDir = "../../test/"
+
+var baseDir string
+
 const dataDir = "./data"
 const testFeedName = "test"
 
 const goodSecret = "b90e516e-b256-41ff-a84e-a9e8d5b6fe30"
 const badSecret = "foo"
 
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ybfeed-handlers")
+	if err != nil {
+		panic(err)
+	}
+	if err = copyDir(fixturesDir, dir); err != nil {
+		panic(err)
+	}
+	baseDir = dir
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// copyDir copies the content of directory src into directory dst
+func copyDir(src string, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, b, 0600)
+	})
+}
+
 type APITestRequest struct {
 	method      string
 	feed        string
 	item        string
 	body        io.Reader
 	contentType string
+	action      string
+	suffix      string
+	secret      string
+	headers     map[string]string
 
 	cookieAuthType AuthType
 	queryAuthType  AuthType
@@ -47,6 +102,7 @@ func (t APITestRequest) performRequest() (*http.Response, error) {
 		return nil, err
 	}
 	api.MaxBodySize = 5 * 1024 * 1024
+	api.AnonymousFeeds = true
 	r := api.GetServer()
 
 	authQuery := ""
@@ -57,18 +113,52 @@ func (t APITestRequest) performRequest() (*http.Response, error) {
 		authQuery = "?secret=" + badSecret
 	}
 
-	path := "/api/feed/"
+	path := "/api/feeds/"
 	if t.feed == "" {
 		path = path + url.QueryEscape(testFeedName)
 	} else {
 		path = path + url.QueryEscape(t.feed)
 	}
 
+	if t.action != "" {
+		path = path + "/" + t.action
+	}
+
 	if t.item != "" {
-		path = path + "/" + url.QueryEscape(t.item)
+		path = path + "/items/" + url.QueryEscape(t.item)
+	}
+
+	if t.suffix != "" {
+		path = path + "/" + t.suffix
+	}
+
+	body := t.body
+	contentType := t.contentType
+
+	// Items are posted to a feed as the first part of a multipart body
+	if t.method == http.MethodPost && t.action == "" && t.item == "" && t.suffix == "" {
+		buf := &bytes.Buffer{}
+		mw := multipart.NewWriter(buf)
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="file"`)
+		h.Set("Content-Type", t.contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if t.body != nil {
+			if _, err = io.Copy(part, t.body); err != nil {
+				return nil, err
+			}
+		}
+		if err = mw.Close(); err != nil {
+			return nil, err
+		}
+		body = buf
+		contentType = mw.FormDataContentType()
 	}
 
-	req := httptest.NewRequest(t.method, path+authQuery, t.body)
+	req := httptest.NewRequest(t.method, path+authQuery, body)
 
 	switch t.cookieAuthType {
 	case AuthTypeAuth:
@@ -77,8 +167,16 @@ func (t APITestRequest) performRequest() (*http.Response, error) {
 		req.AddCookie(&http.Cookie{Name: "Secret", Value: badSecret})
 	}
 
-	if t.contentType != "" {
-		req.Header.Add("Content-type", t.contentType)
+	if t.secret != "" {
+		req.AddCookie(&http.Cookie{Name: "Secret", Value: t.secret})
+	}
+
+	if contentType != "" {
+		req.Header.Add("Content-type", contentType)
+	}
+
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
 	}
 	w := httptest.NewRecorder()
 
@@ -106,7 +204,7 @@ func TestFirstStart(t *testing.T) {
 	}
 
 	if c.NotificationSettings == nil ||
-		len(c.NotificationSettings.VAPIDPrivateKey) == 0 ||
+		len(c.NotificationSettings.VAPIDPublicKey) == 0 ||
 		len(c.NotificationSettings.VAPIDPrivateKey) == 0 {
 		t.Error("Invalid config file")
 	}
@@ -371,9 +469,59 @@ func TestSetBadPin(t *testing.T) {
 	}
 }
 
+func TestFeedSettings(t *testing.T) {
+	t.Cleanup(func() {
+		c, _ := feed.FeedConfigForFeed(
+			&feed.Feed{
+				Path: path.Join(baseDir, dataDir, testFeedName),
+			},
+		)
+		c.Description = ""
+		c.Retention = 0
+		_ = c.Write()
+	})
+
+	res, _ := APITestRequest{
+		method:         http.MethodPatch,
+		action:         "settings",
+		body:           strings.NewReader(`{"description":"notes"}`),
+		cookieAuthType: AuthTypeFail,
+	}.performRequest()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	res, _ = APITestRequest{
+		method:         http.MethodPatch,
+		action:         "settings",
+		body:           strings.NewReader(`{"description":"notes","retention":"1h"}`),
+		cookieAuthType: AuthTypeAuth,
+	}.performRequest()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	var settings feed.FeedSettings
+	if err := json.NewDecoder(res.Body).Decode(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings.Description != "notes" || settings.Retention != feed.Duration(time.Hour) {
+		t.Fatalf("Unexpected settings %+v", settings)
+	}
+
+	res, _ = APITestRequest{
+		method:         http.MethodPatch,
+		action:         "settings",
+		body:           strings.NewReader(`{"retention":"-1h"}`),
+		cookieAuthType: AuthTypeAuth,
+	}.performRequest()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expect code 400 but got %d", res.StatusCode)
+	}
+}
+
 func TestAddAndRemoveContent(t *testing.T) {
 	filePath := path.Join(baseDir, dataDir, testFeedName, "Pasted Image 1.png")
-	newFilePath := path.Join(baseDir, dataDir, testFeedName, "Pasted Image 2.png")
+	newFilePath := path.Join(baseDir, dataDir, testFeedName, "Pasted Image.png")
 
 	t.Cleanup(func() {
 		os.Remove(newFilePath)
@@ -404,7 +552,7 @@ func TestAddAndRemoveContent(t *testing.T) {
 	// Delete request
 	res, _ = APITestRequest{
 		method:         http.MethodDelete,
-		item:           "Pasted Image 2.png",
+		item:           "Pasted Image.png",
 		cookieAuthType: AuthTypeAuth,
 	}.performRequest()
 
@@ -514,7 +662,7 @@ func TestSubscribeFeedNotifications(t *testing.T) {
 	res, _ := APITestRequest{
 		method:         http.MethodPost,
 		feed:           testFeedName,
-		item:           "subscription",
+		action:         "subscription",
 		cookieAuthType: AuthTypeAuth,
 		body:           b,
 	}.performRequest()
@@ -548,6 +696,1097 @@ func TestSubscribeFeedNotifications(t *testing.T) {
 	}
 }
 
+func TestScopedTokens(t *testing.T) {
+	const item = "Pasted Image 1.png"
+
+	fm := feed.NewFeedManager(path.Join(baseDir, dataDir), nil)
+	f, err := fm.GetFeed(testFeedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		f.Config.Tokens = nil
+		_ = f.Config.Write()
+		os.Remove(path.Join(baseDir, dataDir, testFeedName, "Pasted Text.txt"))
+	})
+
+	readToken, err := f.Config.AddToken("broadcast", feed.Scopes{feed.ScopeRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToken, err := f.Config.AddToken("dropbox", feed.Scopes{feed.ScopeWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		req    APITestRequest
+		status int
+	}{
+		{"read get item", APITestRequest{method: http.MethodGet, item: item, secret: readToken.Token}, 200},
+		{"read post item", APITestRequest{method: http.MethodPost, contentType: "text/plain", body: strings.NewReader("test"), secret: readToken.Token}, 403},
+		{"read delete item", APITestRequest{method: http.MethodDelete, item: item, secret: readToken.Token}, 403},
+		{"read set pin", APITestRequest{method: http.MethodPatch, body: strings.NewReader("1234"), secret: readToken.Token}, 403},
+		{"read empty feed", APITestRequest{method: http.MethodDelete, action: "items", secret: readToken.Token}, 403},
+		{"write get item", APITestRequest{method: http.MethodGet, item: item, secret: writeToken.Token}, 403},
+		{"write post item", APITestRequest{method: http.MethodPost, contentType: "text/plain", body: strings.NewReader("test"), secret: writeToken.Token}, 200},
+		{"write list tokens", APITestRequest{method: http.MethodGet, action: "tokens", secret: writeToken.Token}, 403},
+		{"admin list tokens", APITestRequest{method: http.MethodGet, action: "tokens", cookieAuthType: AuthTypeAuth}, 200},
+	}
+
+	for _, tt := range tests {
+		res, err := tt.req.performRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tt.status {
+			t.Errorf("%s: expect code %d but got %d", tt.name, tt.status, res.StatusCode)
+		}
+	}
+
+	// Secret must not be disclosed to non admin tokens
+	res, _ := APITestRequest{
+		method: http.MethodGet,
+		secret: readToken.Token,
+	}.performRequest()
+
+	var pf feed.PublicFeed
+	if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+		t.Fatal(err)
+	}
+	if pf.Secret != "" {
+		t.Errorf("Feed secret disclosed to read only token")
+	}
+	if len(pf.Items) == 0 {
+		t.Errorf("Expected items for read only token")
+	}
+}
+
+func TestSignedItemLink(t *testing.T) {
+	const item = "Pasted Image 1.png"
+
+	res, _ := APITestRequest{
+		method:         http.MethodPost,
+		item:           item,
+		cookieAuthType: AuthTypeAuth,
+		suffix:         "link",
+	}.performRequest()
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	var link SignedLink
+	if err := json.NewDecoder(res.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := api.GetServer()
+
+	// Signed link without any secret
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link.URL, nil))
+	if w.Result().StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", w.Result().StatusCode)
+	}
+
+	// Signature is scoped to the item
+	w = httptest.NewRecorder()
+	u := strings.Replace(link.URL, url.QueryEscape(item), url.QueryEscape("Pasted Text 1.txt"), 1)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u, nil))
+	if w.Result().StatusCode != 403 {
+		t.Errorf("Expect code 403 but got %d", w.Result().StatusCode)
+	}
+
+	// Expired link
+	w = httptest.NewRecorder()
+	expires := time.Now().Add(-time.Minute).Unix()
+	f, err := api.FeedManager.GetFeed(testFeedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := api.signItem(f, item, expires)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u = fmt.Sprintf("/api/feeds/%s/items/%s?expires=%d&signature=%s",
+		testFeedName,
+		url.QueryEscape(item),
+		expires,
+		signature)
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u, nil))
+	if w.Result().StatusCode != 403 {
+		t.Errorf("Expect code 403 but got %d", w.Result().StatusCode)
+	}
+
+	// Minting links requires authentication
+	res, _ = APITestRequest{
+		method: http.MethodPost,
+		item:   item,
+		suffix: "link",
+	}.performRequest()
+
+	if res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+}
+
+func TestSignedItemLinkRevoked(t *testing.T) {
+	const item = "Signed.txt"
+	itemPath := path.Join(baseDir, dataDir, testFeedName, item)
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := api.GetServer()
+	f, err := api.FeedManager.GetFeed(testFeedName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Remove(itemPath)
+		f.Config.Secret = goodSecret
+		_ = f.Config.Write()
+	})
+
+	// link returns a link to item signed now
+	link := func() string {
+		expires := time.Now().Add(time.Hour).Unix()
+		signature, err := api.signItem(f, item, expires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("/api/feeds/%s/items/%s?expires=%d&signature=%s",
+			testFeedName, url.QueryEscape(item), expires, signature)
+	}
+	// get returns the status of a request to u
+	get := func(u string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, u, nil))
+		return w.Result().StatusCode
+	}
+
+	if err = os.WriteFile(itemPath, []byte("first"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	u := link()
+	if code := get(u); code != 200 {
+		t.Fatalf("Expect code 200 but got %d", code)
+	}
+
+	// Links don't give access to a new item with the same name
+	if err = os.WriteFile(itemPath, []byte("second item"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(u); code != 403 {
+		t.Errorf("Expect code 403 for a replaced item but got %d", code)
+	}
+
+	// Rotating the feed secret revokes links
+	u = link()
+	if err = f.Config.RotateSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(u); code != 403 {
+		t.Errorf("Expect code 403 after rotating the secret but got %d", code)
+	}
+}
+
+func TestSigningPurposes(t *testing.T) {
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := api.signValue(signingPurposeSession, Session{User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s Session
+	if err = api.verifyValue(signingPurposeSession, v, &s); err != nil || s.User != "alice" {
+		t.Fatalf("Expect valid session but got %v", err)
+	}
+
+	// A value signed for a purpose can't be used for another one
+	var state oidcState
+	if err = api.verifyValue(signingPurposeOIDCState, v, &state); !errors.Is(err, SessionErrorInvalid) {
+		t.Fatalf("Expect %v but got %v", SessionErrorInvalid, err)
+	}
+}
+
+func TestAdminSecrets(t *testing.T) {
+	const adminToken = "admin-token"
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := api.GetServer()
+
+	request := func(token string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/secrets", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// Admin API is disabled without an admin token
+	if res := request(adminToken); res.StatusCode != 404 {
+		t.Errorf("Expect code 404 but got %d", res.StatusCode)
+	}
+
+	api.Config.AdminToken = adminToken
+
+	if res := request(""); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	if res := request("foo"); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	res := request(adminToken)
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	var secrets []feed.FeedSecret
+	if err = json.NewDecoder(res.Body).Decode(&secrets); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, s := range secrets {
+		if s.Name == testFeedName && s.Secret == goodSecret {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Secret for feed %s not found in %v", testFeedName, secrets)
+	}
+}
+
+func TestCreateFeedCookieAttributes(t *testing.T) {
+	const feedName = "cookie"
+
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, feedName))
+	})
+
+	res, _ := APITestRequest{
+		method:  http.MethodGet,
+		feed:    feedName,
+		headers: map[string]string{"X-Forwarded-Proto": "https"},
+	}.performRequest()
+
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	var cookie *http.Cookie
+	for _, c := range res.Cookies() {
+		if c.Name == "Secret" {
+			cookie = c
+		}
+	}
+
+	if cookie == nil {
+		t.Fatal("Cookie is not present in reply")
+	}
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Unexpected cookie attributes: %s", cookie.String())
+	}
+}
+
+func TestCrossOriginRequest(t *testing.T) {
+	t.Cleanup(func() {
+		c, _ := feed.FeedConfigForFeed(
+			&feed.Feed{
+				Path: path.Join(baseDir, dataDir, testFeedName),
+			},
+		)
+		c.PIN = nil
+		_ = c.Write()
+	})
+
+	res, _ := APITestRequest{
+		method:         http.MethodPatch,
+		body:           strings.NewReader("1234"),
+		cookieAuthType: AuthTypeAuth,
+		headers:        map[string]string{"Origin": "https://evil.example.org"},
+	}.performRequest()
+
+	if res.StatusCode != 403 {
+		t.Errorf("Expect code 403 but got %d", res.StatusCode)
+	}
+
+	res, _ = APITestRequest{
+		method:         http.MethodPatch,
+		body:           strings.NewReader("1234"),
+		cookieAuthType: AuthTypeAuth,
+		headers:        map[string]string{"Origin": "http://example.com"},
+	}.performRequest()
+
+	if res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// X-Forwarded-Host is ignored unless sent by a trusted proxy
+	res, _ = APITestRequest{
+		method:         http.MethodPatch,
+		body:           strings.NewReader("1234"),
+		cookieAuthType: AuthTypeAuth,
+		headers: map[string]string{
+			"Origin":           "https://evil.example.org",
+			"X-Forwarded-Host": "evil.example.org",
+		},
+	}.performRequest()
+
+	if res.StatusCode != 403 {
+		t.Errorf("Expect code 403 but got %d", res.StatusCode)
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	api := &ApiHandler{}
+
+	var err error
+	api.TrustedProxies, err = ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ParseTrustedProxies([]string{"foo"}); !errors.Is(err, ErrorInvalidTrustedProxy) {
+		t.Errorf("Expect %v but got %v", ErrorInvalidTrustedProxy, err)
+	}
+
+	tests := map[string]bool{
+		"192.0.2.1:1234": true,
+		"10.1.2.3:1234":  true,
+		"192.0.2.2:1234": false,
+	}
+	for remoteAddr, expected := range tests {
+		r := httptest.NewRequest(http.MethodPost, "http://internal:8080/api/feeds", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Origin", "https://feeds.example.com")
+		r.Header.Set("X-Forwarded-Host", "feeds.example.com")
+		if api.isAllowedOrigin(r) != expected {
+			t.Errorf("Expect origin allowed %v from %s", expected, remoteAddr)
+		}
+	}
+}
+
+func TestCreateFeedExplicitly(t *testing.T) {
+	const feedName = "created"
+
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, feedName))
+	})
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	api.ImplicitFeeds = false
+	r := api.GetServer()
+
+	request := func(method string, target string, body string) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	// Unknown feeds aren't created implicitly
+	if res := request(http.MethodGet, "/api/feeds/"+feedName, ""); res.StatusCode != 404 {
+		t.Errorf("Expect code 404 but got %d", res.StatusCode)
+	}
+
+	if res := request(http.MethodPost, "/api/feeds", `{"name":"`+feedName+`","retention":"forever"}`); res.StatusCode != 400 {
+		t.Errorf("Expect code 400 but got %d", res.StatusCode)
+	}
+
+	// Names can't point outside of data directory or to its files
+	for _, name := range []string{"..", "../" + feedName, "a/b", "config.json"} {
+		if res := request(http.MethodPost, "/api/feeds", `{"name":"`+name+`"}`); res.StatusCode != 400 {
+			t.Errorf("Expect code 400 for %q but got %d", name, res.StatusCode)
+		}
+	}
+
+	res := request(http.MethodPost, "/api/feeds", `{"name":"`+feedName+`","description":"Created feed","retention":"24h"}`)
+	if res.StatusCode != 201 {
+		t.Fatalf("Expect code 201 but got %d", res.StatusCode)
+	}
+
+	var pf feed.PublicFeed
+	if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+		t.Fatal(err)
+	}
+	if pf.Name != feedName || pf.Description != "Created feed" || pf.Retention != feed.Duration(24*time.Hour) || pf.Secret == "" {
+		t.Errorf("Unexpected feed %+v", pf)
+	}
+
+	if res = request(http.MethodPost, "/api/feeds", `{"name":"`+feedName+`"}`); res.StatusCode != 409 {
+		t.Errorf("Expect code 409 but got %d", res.StatusCode)
+	}
+
+	if res = request(http.MethodGet, "/api/feeds/"+feedName+"?secret="+pf.Secret, ""); res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+}
+
+func TestInvalidFeedName(t *testing.T) {
+	for _, name := range []string{"config.json", "..", "a.b", "pаypal"} {
+		res, _ := APITestRequest{
+			method: http.MethodGet,
+			feed:   name,
+		}.performRequest()
+
+		if res.StatusCode != 400 {
+			t.Errorf("Expect code 400 for %q but got %d", name, res.StatusCode)
+		}
+	}
+
+	res, _ := APITestRequest{
+		method:         http.MethodDelete,
+		feed:           "config.json",
+		action:         "items",
+		cookieAuthType: AuthTypeAuth,
+	}.performRequest()
+
+	if res.StatusCode != 400 {
+		t.Errorf("Expect code 400 but got %d", res.StatusCode)
+	}
+
+	// Invalid names are rejected before looking for the feed, even when
+	// unknown feeds aren't created
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.ImplicitFeeds = false
+	r := api.GetServer()
+
+	for _, name := range []string{"api", "Admin", strings.Repeat("a", feed.MaxFeedNameLength+1)} {
+		for _, target := range []string{
+			"/api/feeds/" + url.PathEscape(name),
+			"/api/feeds/" + url.PathEscape(name) + "/items/item.txt?secret=" + goodSecret,
+		} {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			if w.Code != 400 {
+				t.Errorf("Expect code 400 for %s but got %d", target, w.Code)
+			}
+		}
+	}
+}
+
+func TestRenameFeed(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, "before"))
+		os.RemoveAll(path.Join(baseDir, dataDir, "after"))
+		os.RemoveAll(path.Join(baseDir, dataDir, "café"))
+		os.RemoveAll(path.Join(baseDir, dataDir, "final"))
+		os.Remove(path.Join(baseDir, dataDir, "aliases.json"))
+	})
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Post(server.URL+"/api/feeds", "application/json", strings.NewReader(`{"name":"before"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pf feed.PublicFeed
+	if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+		t.Fatal(err)
+	}
+	secret := pf.Secret
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/before?secret="+secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Renaming to an existing feed fails
+	res, err = client.Post(server.URL+"/api/feeds/before/rename?secret="+secret, "application/json", strings.NewReader(`{"name":"test"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 409 {
+		t.Errorf("Expect code 409 but got %d", res.StatusCode)
+	}
+
+	res, err = client.Post(server.URL+"/api/feeds/before/rename?secret="+secret, "application/json", strings.NewReader(`{"name":"after"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// Connected clients are notified
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var n feed.FeedNotification
+	if err = c.ReadJSON(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Action != "renamed" || n.Name != "after" {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+
+	// Previous name redirects to the new name
+	res, err = client.Get(server.URL + "/api/feeds/before/items/foo?secret=" + secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusPermanentRedirect {
+		t.Fatalf("Expect code 308 but got %d", res.StatusCode)
+	}
+	if l := res.Header.Get("Location"); l != "/api/feeds/after/items/foo?secret="+secret {
+		t.Errorf("Unexpected redirect to %s", l)
+	}
+
+	res, err = client.Get(server.URL + "/api/feeds/after?secret=" + secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// The secret cookie follows the redirect
+	cookies := func(res *http.Response) map[string]*http.Cookie {
+		result := map[string]*http.Cookie{}
+		for _, c := range res.Cookies() {
+			if c.Name == "Secret" {
+				result[c.Path] = c
+			}
+		}
+		return result
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/feeds/before", nil)
+	req.AddCookie(&http.Cookie{Name: "Secret", Value: secret})
+	if res, err = client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	moved := cookies(res)
+	if c := moved["/api/feeds/after"]; c == nil || c.Value != secret {
+		t.Errorf("Expect secret cookie on new path but got %v", moved)
+	}
+	if c := moved["/api/feeds/before"]; c == nil || c.MaxAge >= 0 {
+		t.Errorf("Expect secret cookie on previous path to be deleted but got %v", moved)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/api/feeds/before", nil)
+	req.AddCookie(&http.Cookie{Name: "Secret", Value: "wrong"})
+	if res, err = client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	if moved = cookies(res); len(moved) != 0 {
+		t.Errorf("Expect invalid secret cookie not to be moved but got %v", moved)
+	}
+
+	// Web UI page of previous name redirects too
+	if res, err = client.Get(server.URL + "/before"); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusPermanentRedirect || res.Header.Get("Location") != "/after" {
+		t.Errorf("Expect redirect to /after but got %d %s", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	// Cookie of previous name is deleted on its normalized path
+	res, err = client.Post(server.URL+"/api/feeds/after/rename?secret="+secret, "application/json", strings.NewReader(`{"name":"café"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	res, err = client.Post(server.URL+"/api/feeds/cafe%CC%81/rename?secret="+secret, "application/json", strings.NewReader(`{"name":"final"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	if c := cookies(res)["/api/feeds/caf%C3%A9"]; c == nil || c.MaxAge >= 0 {
+		t.Errorf("Expect secret cookie of café to be deleted but got %v", cookies(res))
+	}
+}
+
+func TestDeleteFeed(t *testing.T) {
+	const adminToken = "admin-token"
+
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, "deleted"))
+		os.RemoveAll(path.Join(baseDir, dataDir, "deleted-admin"))
+	})
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	api.Config.AdminToken = adminToken
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	create := func(name string) string {
+		res, err := http.Post(server.URL+"/api/feeds", "application/json", strings.NewReader(`{"name":"`+name+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pf feed.PublicFeed
+		if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+			t.Fatal(err)
+		}
+		return pf.Secret
+	}
+
+	remove := func(name string, secret string, token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/feeds/"+name+"?secret="+secret, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	secret := create("deleted")
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/deleted?secret="+secret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if res := remove("deleted", badSecret, ""); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	if res := remove("deleted", secret, ""); res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// Websockets are closed with a dedicated code
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = c.ReadMessage()
+	if !ws.IsCloseError(err, feed.CloseFeedDeleted) {
+		t.Errorf("Expect close code %d but got %v", feed.CloseFeedDeleted, err)
+	}
+
+	if _, err = os.Stat(path.Join(baseDir, dataDir, "deleted")); !os.IsNotExist(err) {
+		t.Errorf("Feed directory still exists")
+	}
+
+	if res := remove("deleted", secret, ""); res.StatusCode != 404 {
+		t.Errorf("Expect code 404 but got %d", res.StatusCode)
+	}
+
+	// Server administrators can delete any feed
+	create("deleted-admin")
+
+	if res := remove("deleted-admin", "", adminToken); res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+}
+
+func TestAdminFeeds(t *testing.T) {
+	const adminToken = "admin-token"
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Config.AdminToken = adminToken
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/"+testFeedName+"?secret="+goodSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Make sure the websocket is registered before asking for statistics
+	if err = c.WriteMessage(ws.TextMessage, []byte("feed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/admin/feeds", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	var stats []feed.FeedStats
+	if err = json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+
+	var s *feed.FeedStats
+	for i := range stats {
+		if stats[i].Name == testFeedName {
+			s = &stats[i]
+		}
+	}
+	if s == nil {
+		t.Fatalf("Feed %s not found in %v", testFeedName, stats)
+	}
+	if s.Items == 0 || s.Bytes == 0 || s.LastActivity.IsZero() || s.WebSockets != 1 {
+		t.Errorf("Unexpected statistics %+v", s)
+	}
+}
+
+func TestFeedEvents(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, "events"))
+	})
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	res, err := http.Post(server.URL+"/api/feeds", "application/json", strings.NewReader(`{"name":"events"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pf feed.PublicFeed
+	if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+		t.Fatal(err)
+	}
+	secret := pf.Secret
+
+	f, err := api.FeedManager.GetFeed("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stream opens the event stream and returns a function reading the next
+	// event id and data
+	stream := func(lastEventID string) (*http.Response, func() (string, feed.FeedNotification)) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/feeds/events/events?secret="+secret, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != 200 {
+			t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Expect event stream but got %s", ct)
+		}
+
+		r := bufio.NewReader(res.Body)
+		return res, func() (string, feed.FeedNotification) {
+			var id string
+			var n feed.FeedNotification
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					t.Fatal(err)
+				}
+				line = strings.TrimSuffix(line, "\n")
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "data: "):
+					if err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &n); err != nil {
+						t.Fatal(err)
+					}
+				case line == "" && n.Action != "":
+					return id, n
+				}
+			}
+		}
+	}
+
+	waitForCount := func(count int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for api.WebSocketManager.Count("events") != count {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expect %d clients", count)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	res, next := stream("")
+	waitForCount(1)
+
+	if err = f.AddItem("text/plain", "", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	id, n := next()
+	if id != "1" || n.Action != "add" || n.Item.Name != "Pasted Text.txt" {
+		t.Errorf("Unexpected event %s %+v", id, n)
+	}
+	res.Body.Close()
+	waitForCount(0)
+
+	// Events missed while disconnected are sent on reconnection
+	if err = f.RemoveItem("Pasted Text.txt", true); err != nil {
+		t.Fatal(err)
+	}
+	res, next = stream("1")
+	defer res.Body.Close()
+	id, n = next()
+	if id != "2" || n.Action != "remove" {
+		t.Errorf("Expect remove event 2 but got %s %+v", id, n)
+	}
+
+	// Authentication is the same as the API
+	res, err = http.Get(server.URL + "/api/feeds/events/events?secret=" + badSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+}
+
+func TestFeedPoll(t *testing.T) {
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, "polled"))
+	})
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	res, err := http.Post(server.URL+"/api/feeds", "application/json", strings.NewReader(`{"name":"polled"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pf feed.PublicFeed
+	if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+		t.Fatal(err)
+	}
+	secret := pf.Secret
+
+	poll := func(query string) (int, feed.PollResult) {
+		res, err := http.Get(server.URL + "/api/feeds/polled/poll?secret=" + secret + "&" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var r feed.PollResult
+		if res.StatusCode == 200 {
+			if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res.StatusCode, r
+	}
+
+	code, r := poll("timeout=10ms")
+	if code != 200 || r.Seq != 0 || len(r.Notifications) != 0 {
+		t.Errorf("Expect empty result but got %d %+v", code, r)
+	}
+
+	f, err := api.FeedManager.GetFeed("polled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.AddItem("text/plain", "", strings.NewReader("polled")); err != nil {
+		t.Fatal(err)
+	}
+
+	code, r = poll("since=0")
+	if code != 200 || r.Seq != 1 || len(r.Notifications) != 1 || r.Notifications[0].Action != "add" {
+		t.Errorf("Expect add notification but got %d %+v", code, r)
+	}
+
+	for _, query := range []string{"since=foo", "timeout=foo", "timeout=1h"} {
+		if code, _ = poll(query); code != 400 {
+			t.Errorf("%s: expect code 400 but got %d", query, code)
+		}
+	}
+}
+
+func TestMultipleFeedsWebSocket(t *testing.T) {
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tests := []struct {
+		command feed.Command
+		code    int
+	}{
+		{feed.Command{ID: "1", Command: feed.CommandSubscribe, Feed: testFeedName, Secret: badSecret}, http.StatusUnauthorized},
+		{feed.Command{ID: "2", Command: feed.CommandSubscribe, Feed: "unknown", Secret: goodSecret}, http.StatusNotFound},
+		{feed.Command{ID: "3", Command: feed.CommandSubscribe, Feed: testFeedName, Secret: goodSecret}, 0},
+	}
+	for _, test := range tests {
+		if err = c.WriteJSON(test.command); err != nil {
+			t.Fatal(err)
+		}
+		var r feed.CommandResponse
+		if err = c.ReadJSON(&r); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case test.code == 0 && r.Error != nil:
+			t.Fatalf("Unexpected error for %s: %v", test.command.ID, r.Error)
+		case test.code != 0 && (r.Error == nil || r.Error.Code != test.code):
+			t.Fatalf("Expect error %d for %s but got %v", test.code, test.command.ID, r.Error)
+		}
+	}
+
+	if count := api.WebSocketManager.Count(testFeedName); count != 1 {
+		t.Fatalf("Expect 1 websocket but got %d", count)
+	}
+}
+
+func TestFeedPresence(t *testing.T) {
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	c, _, err := ws.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/"+testFeedName+"?device=phone&secret="+goodSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Make sure the websocket is registered
+	if err = c.WriteMessage(ws.TextMessage, []byte("feed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Get(server.URL + "/api/feeds/" + testFeedName + "/presence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(server.URL + "/api/feeds/" + testFeedName + "/presence?secret=" + goodSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	var devices []feed.Device
+	if err = json.NewDecoder(res.Body).Decode(&devices); err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].Name != "phone" || devices[0].UserAgent == "" {
+		t.Fatalf("Unexpected presence %+v", devices)
+	}
+}
+
+func TestFeedWebSocketCookie(t *testing.T) {
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+
+	u := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/feeds/" + testFeedName + "/ws"
+
+	// The secret cookie set on the feed path authenticates the websocket
+	header := http.Header{}
+	header.Set("Cookie", (&http.Cookie{Name: "Secret", Value: goodSecret}).String())
+	c, _, err := ws.DefaultDialer.Dial(u, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err = c.WriteMessage(ws.TextMessage, []byte("feed")); err != nil {
+		t.Fatal(err)
+	}
+	var pf feed.PublicFeed
+	if err = c.ReadJSON(&pf); err != nil {
+		t.Fatal(err)
+	}
+	if pf.Name != testFeedName {
+		t.Errorf("Expect feed %s but got %s", testFeedName, pf.Name)
+	}
+
+	// Without it, the websocket is closed
+	c, _, err = ws.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = c.ReadMessage()
+	if !ws.IsCloseError(err, 4401) {
+		t.Errorf("Expect close code 4401 but got %v", err)
+	}
+}
+
 // func TestConnectWebSocket(t *testing.T) {
 // 	api, err := NewApiHandler(path.Join(baseDir, dataDir))
 // 	if err != nil {
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ybizeul/ybfeed/internal/feed"
+	"github.com/ybizeul/ybfeed/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// Signed links durations
+const (
+	defaultLinkTTL = time.Hour
+	maxLinkTTL     = 7 * 24 * time.Hour
+)
+
+// Errors related to signed links
+var (
+	LinkErrorInvalidSignature = errors.New("invalid signature")
+	LinkErrorExpired          = errors.New("link expired")
+)
+
+// SignedLink is returned to the client when a signed link to an item is
+// requested
+type SignedLink struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// generateSigningKey returns a new random key suitable to sign item links
+func generateSigningKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// Purposes of the keys derived from the signing key, so that a value signed
+// for one purpose is never accepted for another
+const (
+	signingPurposeItemLink  = "item link"
+	signingPurposeSession   = "session"
+	signingPurposeOIDCState = "oidc state"
+)
+
+// signingKey returns the key used to sign values for purpose, derived from
+// the configured signing key
+func (api *ApiHandler) signingKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(api.Config.SigningKey))
+	mac.Write([]byte("ybfeed " + purpose))
+	return mac.Sum(nil)
+}
+
+// signItem returns the signature of itemName in feed f valid until expires.
+// The signature covers the current content of the item and the feed
+// secret, so that links stop working when the item is replaced or the
+// secret is rotated.
+func (api *ApiHandler) signItem(f *feed.Feed, itemName string, expires int64) (string, error) {
+	fingerprint, err := f.ItemFingerprint(itemName)
+	if err != nil {
+		return "", err
+	}
+	secret := sha256.Sum256([]byte(f.Config.Secret))
+
+	mac := hmac.New(sha256.New, api.signingKey(signingPurposeItemLink))
+	fmt.Fprintf(mac, "%s\x00%s\x00%d\x00%s\x00%x", f.Name(), itemName, expires, fingerprint, secret)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyItemSignature returns an error if signature isn't valid for itemName
+// in feed f, or if the link expired
+func (api *ApiHandler) verifyItemSignature(f *feed.Feed, itemName, expires, signature string) error {
+	e, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad expiration", LinkErrorInvalidSignature)
+	}
+
+	// Items that don't exist anymore are reported like invalid signatures,
+	// links don't tell anything about the feed
+	expected, err := api.signItem(f, itemName, e)
+	if err != nil || !hmac.Equal([]byte(expected), []byte(signature)) {
+		return LinkErrorInvalidSignature
+	}
+
+	if time.Now().Unix() > e {
+		return LinkErrorExpired
+	}
+
+	return nil
+}
+
+// itemLinkPostFunc returns a signed URL giving access to a single item without
+// the feed secret, until it expires. Expiration can be set with the ttl
+// query parameter, as a duration (defaults to one hour)
+func (api *ApiHandler) itemLinkPostFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Item API link request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeRead)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	feedItem, _ := url.QueryUnescape(chi.URLParam(r, "itemName"))
+	if feedItem == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed item")
+		return
+	}
+
+	if _, err = f.GetPublicItem(feedItem); err != nil {
+		switch {
+		case errors.Is(err, feed.FeedErrorItemNotFound), errors.Is(err, feed.FeedErrorInvalidFeedItem):
+			utils.CloseWithCodeAndMessage(w, 404, "Item does not exists")
+		default:
+			utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		}
+		return
+	}
+
+	ttl := defaultLinkTTL
+	if t := r.URL.Query().Get("ttl"); t != "" {
+		ttl, err = time.ParseDuration(t)
+		if err != nil || ttl <= 0 || ttl > maxLinkTTL {
+			utils.CloseWithCodeAndMessage(w, 400, fmt.Sprintf("ttl should be a duration up to %s", maxLinkTTL))
+			return
+		}
+	}
+
+	expires := time.Now().Add(ttl)
+
+	scheme := "http"
+	if isSecureRequest(r) {
+		scheme = "https"
+	}
+
+	signature, err := api.signItem(f, feedItem, expires.Unix())
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", signature)
+
+	// Names are escaped the same way as the web UI does, as they are
+	// unescaped with url.QueryUnescape when handling the request
+	u := fmt.Sprintf("%s://%s/api/feeds/%s/items/%s?%s",
+		scheme,
+		r.Host,
+		url.QueryEscape(f.Name()),
+		url.QueryEscape(feedItem),
+		q.Encode())
+
+	WriteSuccessJSON(w, SignedLink{
+		URL:     u,
+		Expires: expires,
+	})
+}
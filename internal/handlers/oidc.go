@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/exp/slog"
+	"golang.org/x/oauth2"
+
+	"github.com/ybizeul/ybfeed/internal/utils"
+)
+
+// oidcStateCookieName is the name of the cookie holding the login state
+// while the user authenticates with the OpenID Connect provider
+const oidcStateCookieName = "OIDCState"
+
+// oidcStateLifetime is the time allowed to the user to log in
+const oidcStateLifetime = 10 * time.Minute
+
+// OIDCSettings configures login with an OpenID Connect provider
+type OIDCSettings struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// oidcProvider holds the OpenID Connect configuration discovered from
+// the issuer
+type oidcProvider struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// oidcState is stored in a signed cookie during login to validate the
+// callback from the provider
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect"`
+	Expires  int64  `json:"exp"`
+}
+
+// oidcClaims are the claims used to identify a user in the ID token
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+}
+
+// EnableOIDC discovers the provider configuration from settings.Issuer and
+// enables the login endpoints
+func (api *ApiHandler) EnableOIDC(ctx context.Context, settings OIDCSettings) error {
+	provider, err := oidc.NewProvider(ctx, settings.Issuer)
+	if err != nil {
+		return fmt.Errorf("unable to discover OpenID Connect provider: %w", err)
+	}
+
+	api.oidc = &oidcProvider{
+		config: oauth2.Config{
+			ClientID:     settings.ClientID,
+			ClientSecret: settings.ClientSecret,
+			RedirectURL:  settings.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: settings.ClientID}),
+	}
+
+	return nil
+}
+
+// randomString returns a random url safe string
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// localRedirect returns p if it is a path on this server, or "/" to avoid
+// open redirects
+func localRedirect(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+// oidcLoginFunc redirects the browser to the provider for authentication.
+// The redirect query parameter is the path where the user lands after login.
+func (api *ApiHandler) oidcLoginFunc(w http.ResponseWriter, r *http.Request) {
+	state, err := randomString()
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	v, err := api.signValue(signingPurposeOIDCState, oidcState{
+		State:    state,
+		Nonce:    nonce,
+		Redirect: localRedirect(r.URL.Query().Get("redirect")),
+		Expires:  time.Now().Add(oidcStateLifetime).Unix(),
+	})
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	// The provider redirects to the callback with a cross-site navigation,
+	// state cookie must be sent along
+	c := api.newCookie(r, oidcStateCookieName, v, "/auth", oidcStateLifetime)
+	c.SameSite = http.SameSiteLaxMode
+	http.SetCookie(w, c)
+
+	http.Redirect(w, r, api.oidc.config.AuthCodeURL(state, oidc.Nonce(nonce)), http.StatusFound)
+}
+
+// oidcCallbackFunc validates the authentication response from the provider
+// and starts a session for the user
+func (api *ApiHandler) oidcCallbackFunc(w http.ResponseWriter, r *http.Request) {
+	c, err := r.Cookie(oidcStateCookieName)
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Missing login state")
+		return
+	}
+
+	// State cookie is only used once
+	http.SetCookie(w, api.newCookie(r, oidcStateCookieName, "", "/auth", -1))
+
+	var state oidcState
+	if err = api.verifyValue(signingPurposeOIDCState, c.Value, &state); err != nil || time.Now().Unix() > state.Expires {
+		utils.CloseWithCodeAndMessage(w, 400, "Invalid login state")
+		return
+	}
+
+	if r.URL.Query().Get("state") != state.State {
+		utils.CloseWithCodeAndMessage(w, 400, "Invalid login state")
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		utils.CloseWithCodeAndMessage(w, 401, fmt.Sprintf("Login failed: %s", e))
+		return
+	}
+
+	user, err := api.oidcUser(r.Context(), r.URL.Query().Get("code"), state.Nonce)
+	if err != nil {
+		hL.Logger.Error("OpenID Connect login failed", slog.String("error", err.Error()))
+		utils.CloseWithCodeAndMessage(w, 401, "Login failed")
+		return
+	}
+
+	generation, err := api.SessionManager.Generation(user)
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	if err = api.startSession(w, r, Session{User: user, Provider: sessionProviderOIDC, Generation: generation}); err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	hL.Logger.Info("User logged in", slog.String("user", user))
+
+	http.Redirect(w, r, state.Redirect, http.StatusFound)
+}
+
+// oidcUser exchanges code for an ID token and returns the user it identifies.
+// Users are identified by their verified email address, or their subject
+// prefixed by the issuer otherwise.
+func (api *ApiHandler) oidcUser(ctx context.Context, code string, nonce string) (string, error) {
+	token, err := api.oidc.config.Exchange(ctx, code)
+	if err != nil {
+		return "", err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", errors.New("no id_token in token response")
+	}
+
+	idToken, err := api.oidc.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", err
+	}
+
+	var claims oidcClaims
+	if err = idToken.Claims(&claims); err != nil {
+		return "", err
+	}
+
+	if claims.Nonce != nonce {
+		return "", errors.New("invalid nonce")
+	}
+
+	if claims.Email != "" && claims.EmailVerified {
+		return claims.Email, nil
+	}
+
+	return fmt.Sprintf("%s#%s", idToken.Issuer, idToken.Subject), nil
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v3"
+	"github.com/ybizeul/ybfeed/internal/feed"
+)
+
+const oidcClientID = "ybfeed"
+
+// mockOIDCProvider is a minimal OpenID Connect provider issuing ID tokens
+// for a single user
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	email  string
+
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+func newMockOIDCProvider(t *testing.T, email string) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockOIDCProvider{
+		key:    key,
+		email:  email,
+		nonces: map[string]string{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &p.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+
+		p.mu.Lock()
+		nonce, ok := p.nonces[r.Form.Get("code")]
+		p.mu.Unlock()
+
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(t, nonce),
+		})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+// authorize simulates a successful user authentication and returns the
+// authorization code
+func (p *mockOIDCProvider) authorize(nonce string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := "code" + nonce
+	p.nonces[code] = nonce
+	return code
+}
+
+func (p *mockOIDCProvider) idToken(t *testing.T, nonce string) string {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, _ := json.Marshal(map[string]any{
+		"iss":            p.server.URL,
+		"sub":            "1234",
+		"aud":            oidcClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          p.email,
+		"email_verified": true,
+	})
+
+	o, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := o.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestOIDCLogin(t *testing.T) {
+	const user = "alice@example.com"
+	const ownedFeed = "oidc"
+	const adminToken = "admin-token"
+
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, ownedFeed))
+		fm := feed.NewFeedManager(path.Join(baseDir, dataDir), nil)
+		f, _ := fm.GetFeed(testFeedName)
+		_ = f.Config.SetOwner("")
+	})
+
+	provider := newMockOIDCProvider(t, user)
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = api.EnableOIDC(context.Background(), OIDCSettings{
+		Issuer:      provider.server.URL,
+		ClientID:    oidcClientID,
+		RedirectURL: "http://example.com/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := api.GetServer()
+
+	do := func(req *http.Request, cookies ...*http.Cookie) *http.Response {
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	cookie := func(res *http.Response, name string) *http.Cookie {
+		for _, c := range res.Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		t.Fatalf("Cookie %s is not present in reply", name)
+		return nil
+	}
+
+	// Start login
+	res := do(httptest.NewRequest(http.MethodGet, "/auth/login?redirect=/"+ownedFeed, nil))
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("Expect code 302 but got %d", res.StatusCode)
+	}
+	stateCookie := cookie(res, oidcStateCookieName)
+
+	authURL, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := provider.authorize(authURL.Query().Get("nonce"))
+
+	// Callback with a forged state is rejected
+	res = do(httptest.NewRequest(http.MethodGet, "/auth/callback?state=foo&code="+code, nil), stateCookie)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expect code 400 but got %d", res.StatusCode)
+	}
+
+	// Callback from provider
+	res = do(httptest.NewRequest(http.MethodGet, "/auth/callback?state="+authURL.Query().Get("state")+"&code="+code, nil), stateCookie)
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("Expect code 302 but got %d", res.StatusCode)
+	}
+	if res.Header.Get("Location") != "/"+ownedFeed {
+		t.Errorf("Expect redirect to /%s but got %s", ownedFeed, res.Header.Get("Location"))
+	}
+	session := cookie(res, sessionCookieName)
+	if session.MaxAge != int(api.Cookie.SessionMaxAge.Seconds()) {
+		t.Errorf("Expect session lifetime %s but got %ds", api.Cookie.SessionMaxAge, session.MaxAge)
+	}
+
+	// Current user
+	res = do(httptest.NewRequest(http.MethodGet, "/api/me", nil), session)
+	var info UserInfo
+	if err = json.NewDecoder(res.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.User != user {
+		t.Errorf("Expect user %s but got %s", user, info.User)
+	}
+
+	// Feeds created by a logged in user belong to them
+	res = do(httptest.NewRequest(http.MethodGet, "/api/feeds/"+ownedFeed, nil), session)
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// Owned feeds don't need a secret
+	res = do(httptest.NewRequest(http.MethodGet, "/api/feeds/"+ownedFeed, nil), session)
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	var pf feed.PublicFeed
+	if err = json.NewDecoder(res.Body).Decode(&pf); err != nil {
+		t.Fatal(err)
+	}
+	if pf.Secret == "" {
+		t.Errorf("Expect feed secret for owner")
+	}
+
+	// Other feeds still need a secret
+	res = do(httptest.NewRequest(http.MethodGet, "/api/feeds/"+testFeedName, nil), session)
+	if res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	// Claim an existing feed
+	res = do(httptest.NewRequest(http.MethodPost, "/api/feeds/"+testFeedName+"/owner?secret="+goodSecret, nil), session)
+	if res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	res = do(httptest.NewRequest(http.MethodGet, "/api/me/feeds", nil), session)
+	var feeds []feed.UserFeed
+	if err = json.NewDecoder(res.Body).Decode(&feeds); err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 {
+		t.Errorf("Expect 2 owned feeds but got %v", feeds)
+	}
+
+	// Owned feeds can't be claimed by holders of the secret
+	v, err := api.signValue(signingPurposeSession, Session{User: "bob@example.com", Provider: sessionProviderOIDC, Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := &http.Cookie{Name: sessionCookieName, Value: v}
+	res = do(httptest.NewRequest(http.MethodPost, "/api/feeds/"+testFeedName+"/owner?secret="+goodSecret, nil), bob)
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("Expect code 409 but got %d", res.StatusCode)
+	}
+
+	// The owner can transfer the feed
+	res = do(httptest.NewRequest(http.MethodPost, "/api/feeds/"+testFeedName+"/owner", strings.NewReader(`{"user":"bob@example.com"}`)), session)
+	if res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+	res = do(httptest.NewRequest(http.MethodPost, "/api/feeds/"+testFeedName+"/owner?secret="+goodSecret, nil), session)
+	if res.StatusCode != http.StatusConflict {
+		t.Errorf("Expect code 409 but got %d", res.StatusCode)
+	}
+
+	// Logout
+	res = do(httptest.NewRequest(http.MethodPost, "/auth/logout", nil), session)
+	if c := cookie(res, sessionCookieName); c.MaxAge >= 0 {
+		t.Errorf("Expect session cookie to be deleted")
+	}
+
+	// Sessions are revoked by the administrator
+	api.Config.AdminToken = adminToken
+	req := httptest.NewRequest(http.MethodDelete, "/api/admin/sessions/"+url.QueryEscape(user), nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	res = do(req)
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	res = do(httptest.NewRequest(http.MethodGet, "/api/me", nil), session)
+	if res.StatusCode != 401 {
+		t.Errorf("Expect code 401 for a revoked session but got %d", res.StatusCode)
+	}
+}
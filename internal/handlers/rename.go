@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ybizeul/ybfeed/internal/feed"
+	"github.com/ybizeul/ybfeed/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// RenameRequest is the body expected to rename a feed
+type RenameRequest struct {
+	Name string `json:"name"`
+}
+
+// feedAlias redirects requests for the previous name of a renamed feed to
+// the same path on the new name
+func (api *ApiHandler) feedAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+
+		target, ok := api.FeedManager.Alias(feedName)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Replace the feed name segment, keeping the rest of the path
+		const prefix = "/api/feeds/"
+		p := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+		rest := ""
+		if i := strings.Index(p, "/"); i >= 0 {
+			rest = p[i:]
+		}
+
+		location := prefix + url.PathEscape(target) + rest
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+
+		hL.Logger.Debug("Redirecting alias", slog.String("feed", feedName), slog.String("target", target))
+
+		api.moveSecretCookie(w, r, feedName, target)
+
+		http.Redirect(w, r, location, http.StatusPermanentRedirect)
+	})
+}
+
+// uiAlias redirects the web UI page of the previous name of a renamed feed to
+// the page of the new name
+func (api *ApiHandler) uiAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+		if p == "" || strings.Contains(p, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		feedName, _ := url.PathUnescape(p)
+
+		target, ok := api.FeedManager.Alias(feedName)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		location := "/" + url.PathEscape(target)
+		if r.URL.RawQuery != "" {
+			location += "?" + r.URL.RawQuery
+		}
+
+		hL.Logger.Debug("Redirecting alias", slog.String("feed", feedName), slog.String("target", target))
+
+		http.Redirect(w, r, location, http.StatusPermanentRedirect)
+	})
+}
+
+// moveSecretCookie sets the secret cookie of feed oldName, scoped to its
+// path, on the path of feed newName so the browser still sends it after
+// following a redirect. Secrets that aren't valid anymore are not moved.
+func (api *ApiHandler) moveSecretCookie(w http.ResponseWriter, r *http.Request, oldName string, newName string) {
+	secret, fromURL := utils.GetSecret(r)
+	if secret == "" || fromURL {
+		return
+	}
+
+	f, err := api.FeedManager.GetFeed(newName)
+	if err != nil {
+		return
+	}
+	if _, err = f.ScopesForSecret(secret); err != nil {
+		return
+	}
+
+	if normalized, err := feed.NormalizeFeedName(oldName); err == nil {
+		oldName = normalized
+	}
+
+	http.SetCookie(w, api.newCookie(r, "Secret", "", secretCookiePath(oldName), -1))
+	http.SetCookie(w, api.secretCookie(r, f.Name(), secret))
+}
+
+// feedRenamePostFunc renames a feed, the previous name redirects to the new
+// one for a while
+func (api *ApiHandler) feedRenamePostFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed rename request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	var rr RenameRequest
+	if err = json.NewDecoder(r.Body).Decode(&rr); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to parse rename request")
+		return
+	}
+
+	oldName := f.Name()
+
+	f, err = api.FeedManager.RenameFeed(oldName, rr.Name)
+	if err != nil {
+		writeFeedError(w, rr.Name, err)
+		return
+	}
+
+	publicFeed, err := f.Public(feed.Scopes{feed.ScopeAdmin})
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	// Cookies are scoped to the feed path
+	http.SetCookie(w, api.newCookie(r, "Secret", "", secretCookiePath(oldName), -1))
+	http.SetCookie(w, api.secretCookie(r, f.Name(), f.Config.Secret))
+
+	WriteSuccessJSON(w, publicFeed)
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ybizeul/ybfeed/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// Secure cookie modes
+const (
+	CookieSecureAuto   = "auto"
+	CookieSecureAlways = "always"
+	CookieSecureNever  = "never"
+)
+
+var (
+	ErrorInvalidCookieSetting = errors.New("invalid cookie setting")
+	ErrorInvalidTrustedProxy  = errors.New("invalid trusted proxy")
+)
+
+// CookieSettings defines the attributes of the cookie holding the feed
+// secret in the browser.
+type CookieSettings struct {
+	// Secure is one of CookieSecureAuto, CookieSecureAlways or
+	// CookieSecureNever. In auto mode, the cookie is secure when the request
+	// was received over TLS, directly or through a reverse proxy.
+	Secure   string
+	SameSite http.SameSite
+	MaxAge   time.Duration
+
+	// SessionMaxAge is the lifetime of user sessions, shorter than MaxAge
+	// as sessions give access to all the feeds of the user
+	SessionMaxAge time.Duration
+}
+
+// DefaultCookieSettings returns the settings used unless configured otherwise
+func DefaultCookieSettings() CookieSettings {
+	return CookieSettings{
+		Secure:        CookieSecureAuto,
+		SameSite:      http.SameSiteLaxMode,
+		MaxAge:        365 * 24 * time.Hour,
+		SessionMaxAge: 24 * time.Hour,
+	}
+}
+
+// ParseCookieSecure validates a secure cookie mode
+func ParseCookieSecure(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case CookieSecureAuto, CookieSecureAlways, CookieSecureNever:
+		return strings.ToLower(s), nil
+	}
+	return "", fmt.Errorf("%w: secure should be auto, always or never, got %s", ErrorInvalidCookieSetting, s)
+}
+
+// ParseSameSite returns the http.SameSite mode for s, which is one of lax,
+// strict or none
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("%w: samesite should be lax, strict or none, got %s", ErrorInvalidCookieSetting, s)
+}
+
+// isSecureRequest returns true if r has been received over TLS, directly or
+// through a reverse proxy
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// secretCookie returns the cookie used to store secret for feedName
+func (api *ApiHandler) secretCookie(r *http.Request, feedName string, secret string) *http.Cookie {
+	return api.newCookie(r, "Secret", secret, secretCookiePath(feedName), api.Cookie.MaxAge)
+}
+
+// secretCookiePath returns the path of the secret cookie of feedName. It is
+// escaped like the paths requested by browsers, otherwise names with spaces
+// or non ASCII characters would never match.
+func secretCookiePath(feedName string) string {
+	return "/api/feeds/" + url.PathEscape(feedName)
+}
+
+// newCookie returns a cookie with attributes set according to cookie
+// settings. A negative maxAge deletes the cookie.
+func (api *ApiHandler) newCookie(r *http.Request, name string, value string, path string, maxAge time.Duration) *http.Cookie {
+	settings := api.Cookie
+
+	secure := false
+	switch settings.Secure {
+	case CookieSecureAlways:
+		secure = true
+	case CookieSecureNever:
+		secure = false
+	default:
+		secure = isSecureRequest(r)
+	}
+
+	// Browsers reject SameSite=None cookies that are not secure
+	sameSite := settings.SameSite
+	if sameSite == http.SameSiteNoneMode && !secure {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: sameSite,
+	}
+
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(maxAge)
+	} else {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
+
+// checkOrigin is a middleware protecting state changing requests against
+// cross-site request forgery. Requests coming from a browser carry an Origin
+// or Referer header that must match the server host or one of the
+// configured allowed origins. Requests without those headers don't come from
+// a browser and can't be forged that way.
+func (api *ApiHandler) checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !api.isAllowedOrigin(r) {
+			hL.Logger.Warn("Cross origin request blocked",
+				slog.String("request_uri", r.RequestURI),
+				slog.String("origin", r.Header.Get("Origin")),
+				slog.String("referer", r.Header.Get("Referer")))
+			utils.CloseWithCodeAndMessage(w, 403, "Cross origin request blocked")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAllowedOrigin returns true if the origin of r is the server itself or one
+// of the allowed origins
+func (api *ApiHandler) isAllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	// X-Forwarded-Host can be set by any client, it is only relevant when
+	// the request comes from a reverse proxy
+	host := r.Host
+	if fh := r.Header.Get("X-Forwarded-Host"); fh != "" && api.isTrustedProxy(r) {
+		host = fh
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+
+	for _, allowed := range api.AllowedOrigins {
+		a, err := url.Parse(allowed)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(a.Scheme, u.Scheme) && strings.EqualFold(a.Host, u.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTrustedProxies returns the networks of the reverse proxies listed in
+// values, as IP addresses or CIDR ranges
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	result := []*net.IPNet{}
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %s", ErrorInvalidTrustedProxy, v)
+			}
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrorInvalidTrustedProxy, v)
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// isTrustedProxy returns true if r has been sent by one of the trusted
+// reverse proxies
+func (api *ApiHandler) isTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range api.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ybizeul/ybfeed/internal/users"
+	"github.com/ybizeul/ybfeed/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// sessionCookieName is the name of the cookie holding the session of an
+// authenticated user
+const sessionCookieName = "Session"
+
+// Errors related to signed values
+var (
+	SessionErrorInvalid = errors.New("invalid session")
+	SessionErrorExpired = errors.New("session expired")
+	SessionErrorRevoked = errors.New("session revoked")
+)
+
+// sessionProviderOIDC is the provider of sessions of users authenticated
+// with OpenID Connect. Other sessions belong to local users.
+const sessionProviderOIDC = "oidc"
+
+// Session is the content of the session cookie of an authenticated user.
+// Sessions are bound to the generation of the user. Sessions of local users
+// end when the user is deleted, changes password or their sessions are
+// revoked, sessions of OpenID Connect users end when they are revoked.
+type Session struct {
+	User       string `json:"user"`
+	Provider   string `json:"provider,omitempty"`
+	Generation int64  `json:"gen,omitempty"`
+	Expires    int64  `json:"exp"`
+}
+
+// signValue returns a tamper proof representation of v that can be
+// stored on the client side, like in a cookie. It is only accepted by
+// verifyValue for the same purpose.
+func (api *ApiHandler) signValue(purpose string, v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	mac := hmac.New(sha256.New, api.signingKey(purpose))
+	mac.Write([]byte(payload))
+
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifyValue checks the signature of s returned by signValue for purpose
+// and unmarshals its content into v
+func (api *ApiHandler) verifyValue(purpose string, s string, v any) error {
+	payload, signature, found := strings.Cut(s, ".")
+	if !found {
+		return SessionErrorInvalid
+	}
+
+	mac := hmac.New(sha256.New, api.signingKey(purpose))
+	mac.Write([]byte(payload))
+	expected := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return SessionErrorInvalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return SessionErrorInvalid
+	}
+
+	if err = json.Unmarshal(b, v); err != nil {
+		return SessionErrorInvalid
+	}
+
+	return nil
+}
+
+// startSession sets the session cookie for session s
+func (api *ApiHandler) startSession(w http.ResponseWriter, r *http.Request, s Session) error {
+	s.Expires = time.Now().Add(api.Cookie.SessionMaxAge).Unix()
+	v, err := api.signValue(signingPurposeSession, s)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, api.newCookie(r, sessionCookieName, v, "/", api.Cookie.SessionMaxAge))
+
+	return nil
+}
+
+// endSession deletes the session cookie
+func (api *ApiHandler) endSession(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, api.newCookie(r, sessionCookieName, "", "/", -1))
+}
+
+// sessionUser returns the authenticated user of the request, or an empty
+// string for anonymous requests
+func (api *ApiHandler) sessionUser(r *http.Request) string {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+
+	var s Session
+	if err = api.verifyValue(signingPurposeSession, c.Value, &s); err != nil {
+		hL.Logger.Debug("Ignoring session cookie", slog.String("error", err.Error()))
+		return ""
+	}
+
+	if time.Now().Unix() > s.Expires {
+		hL.Logger.Debug("Ignoring session cookie", slog.String("error", SessionErrorExpired.Error()))
+		return ""
+	}
+
+	// Local users may have been deleted or changed password, and sessions
+	// may have been revoked since the session started
+	var generation int64
+	if s.Provider == "" {
+		u, err := api.UserManager.Get(s.User)
+		if err != nil {
+			hL.Logger.Debug("Ignoring session cookie", slog.String("error", err.Error()))
+			return ""
+		}
+		generation = u.Generation
+	} else {
+		generation, err = api.SessionManager.Generation(s.User)
+		if err != nil {
+			hL.Logger.Error("Unable to read session generation", slog.String("error", err.Error()))
+			return ""
+		}
+	}
+	if generation != s.Generation {
+		hL.Logger.Debug("Ignoring session cookie", slog.String("error", SessionErrorRevoked.Error()))
+		return ""
+	}
+
+	return s.User
+}
+
+// revokeSessions ends the existing sessions of user, a local user or a
+// user authenticated with OpenID Connect
+func (api *ApiHandler) revokeSessions(user string) error {
+	err := api.UserManager.RevokeSessions(user)
+	if errors.Is(err, users.UserErrorNotFound) {
+		return api.SessionManager.Revoke(user)
+	}
+	return err
+}
+
+// UserInfo is returned to the client to describe the authenticated user
+type UserInfo struct {
+	User string `json:"user"`
+}
+
+func (api *ApiHandler) meGetFunc(w http.ResponseWriter, r *http.Request) {
+	user := api.sessionUser(r)
+	if user == "" {
+		utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
+		return
+	}
+
+	WriteSuccessJSON(w, UserInfo{User: user})
+}
+
+func (api *ApiHandler) meFeedsGetFunc(w http.ResponseWriter, r *http.Request) {
+	user := api.sessionUser(r)
+	if user == "" {
+		utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
+		return
+	}
+
+	feeds, err := api.FeedManager.FeedsForUser(user)
+	if err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccessJSON(w, feeds)
+}
+
+func (api *ApiHandler) adminSessionsDeleteFunc(w http.ResponseWriter, r *http.Request) {
+	name, _ := url.QueryUnescape(chi.URLParam(r, "userName"))
+	if name == "" {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to obtain user name")
+		return
+	}
+
+	if err := api.revokeSessions(name); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	WriteSuccess(w, fmt.Sprintf("Sessions of %s revoked", name))
+}
+
+func (api *ApiHandler) logoutPostFunc(w http.ResponseWriter, r *http.Request) {
+	api.endSession(w, r)
+	WriteSuccess(w, "Logged out")
+}
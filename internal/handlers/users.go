@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ybizeul/ybfeed/internal/feed"
+	"github.com/ybizeul/ybfeed/internal/users"
+	"github.com/ybizeul/ybfeed/internal/utils"
+	"golang.org/x/exp/slog"
+)
+
+// Credentials is the body expected to log in or create a local user
+type Credentials struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// PasswordRequest is the body expected to change the password of the
+// authenticated user
+type PasswordRequest struct {
+	Current  string `json:"current"`
+	Password string `json:"password"`
+}
+
+// MemberRequest is the body expected when sharing a feed with a user
+type MemberRequest struct {
+	Role feed.Role `json:"role"`
+}
+
+// writeUserError closes the request with the HTTP status matching err
+// returned by the user manager
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, users.UserErrorNotFound):
+		utils.CloseWithCodeAndMessage(w, 404, err.Error())
+	case errors.Is(err, users.UserErrorAlreadyExists):
+		utils.CloseWithCodeAndMessage(w, 409, err.Error())
+	case errors.Is(err, users.UserErrorInvalidName), errors.Is(err, users.UserErrorPasswordTooShort):
+		utils.CloseWithCodeAndMessage(w, 400, err.Error())
+	case errors.Is(err, users.UserErrorInvalidCredential):
+		utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
+	default:
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+	}
+}
+
+// loginPostFunc authenticates a local user and starts a session
+func (api *ApiHandler) loginPostFunc(w http.ResponseWriter, r *http.Request) {
+	var c Credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to parse credentials")
+		return
+	}
+
+	user, err := api.UserManager.Authenticate(c.Name, c.Password)
+	if err != nil {
+		hL.Logger.Warn("Failed login", slog.String("user", c.Name), slog.String("remote_addr", r.RemoteAddr))
+		writeUserError(w, err)
+		return
+	}
+
+	if err = api.startSession(w, r, Session{User: user.Name, Generation: user.Generation}); err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	hL.Logger.Info("User logged in", slog.String("user", user.Name))
+
+	WriteSuccessJSON(w, UserInfo{User: user.Name})
+}
+
+// mePasswordPostFunc changes the password of the authenticated local user
+func (api *ApiHandler) mePasswordPostFunc(w http.ResponseWriter, r *http.Request) {
+	user := api.sessionUser(r)
+	if user == "" {
+		utils.CloseWithCodeAndMessage(w, 401, "Unauthorized")
+		return
+	}
+
+	var pr PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to parse credentials")
+		return
+	}
+
+	// A stolen session isn't enough to take over the account
+	if _, err := api.UserManager.Authenticate(user, pr.Current); err != nil {
+		hL.Logger.Warn("Failed password change", slog.String("user", user), slog.String("remote_addr", r.RemoteAddr))
+		writeUserError(w, err)
+		return
+	}
+
+	if err := api.UserManager.SetPassword(user, pr.Password); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	// Other sessions ended with the password change, the current one is
+	// renewed
+	u, err := api.UserManager.Get(user)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	if err = api.startSession(w, r, Session{User: u.Name, Generation: u.Generation}); err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccess(w, "Password changed")
+}
+
+func (api *ApiHandler) adminUsersGetFunc(w http.ResponseWriter, r *http.Request) {
+	names, err := api.UserManager.List()
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	WriteSuccessJSON(w, names)
+}
+
+func (api *ApiHandler) adminUsersPostFunc(w http.ResponseWriter, r *http.Request) {
+	var c Credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to parse user")
+		return
+	}
+
+	user, err := api.UserManager.Create(c.Name, c.Password)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	WriteSuccessJSON(w, UserInfo{User: user.Name})
+}
+
+func (api *ApiHandler) adminUserDeleteFunc(w http.ResponseWriter, r *http.Request) {
+	name, _ := url.QueryUnescape(chi.URLParam(r, "userName"))
+
+	if err := api.UserManager.Delete(name); err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	// A user created later with the same name must not inherit the feeds
+	if err := api.FeedManager.RemoveUser(name); err != nil {
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccess(w, fmt.Sprintf("User %s deleted", name))
+}
+
+func (api *ApiHandler) membersGetFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed members request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	members := f.Config.Members
+	if members == nil {
+		members = []feed.Member{}
+	}
+
+	WriteSuccessJSON(w, members)
+}
+
+func (api *ApiHandler) memberPutFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed member update request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	member, _ := url.QueryUnescape(chi.URLParam(r, "userName"))
+
+	var mr MemberRequest
+	if err = json.NewDecoder(r.Body).Decode(&mr); err != nil {
+		utils.CloseWithCodeAndMessage(w, 400, "Unable to parse member request")
+		return
+	}
+
+	if err = f.Config.SetMember(member, mr.Role); err != nil {
+		switch {
+		case errors.Is(err, feed.FeedErrorInvalidRole),
+			errors.Is(err, feed.FeedErrorMemberIsOwner),
+			errors.Is(err, feed.FeedErrorInvalidMemberID):
+			utils.CloseWithCodeAndMessage(w, 400, err.Error())
+		default:
+			utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		}
+		return
+	}
+
+	WriteSuccessJSON(w, feed.Member{User: member, Role: mr.Role})
+}
+
+func (api *ApiHandler) memberDeleteFunc(w http.ResponseWriter, r *http.Request) {
+	hL.Logger.Debug("Feed member removal request", slog.String("request_uri", r.RequestURI))
+
+	secret, _ := utils.GetSecret(r)
+
+	feedName, _ := url.QueryUnescape(chi.URLParam(r, "feedName"))
+	if feedName == "" {
+		utils.CloseWithCodeAndMessage(w, 500, "Unable to obtain feed name")
+		return
+	}
+
+	f, err := api.FeedManager.GetFeedWithScope(feedName, secret, api.sessionUser(r), feed.ScopeAdmin)
+
+	if err != nil {
+		writeFeedError(w, feedName, err)
+		return
+	}
+
+	member, _ := url.QueryUnescape(chi.URLParam(r, "userName"))
+
+	if err = f.Config.RemoveMember(member); err != nil {
+		if errors.Is(err, feed.FeedErrorMemberNotFound) {
+			utils.CloseWithCodeAndMessage(w, 404, err.Error())
+			return
+		}
+		utils.CloseWithCodeAndMessage(w, 500, err.Error())
+		return
+	}
+
+	WriteSuccess(w, fmt.Sprintf("Feed %s is not shared with %s anymore", feedName, member))
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ybizeul/ybfeed/internal/feed"
+)
+
+func TestLocalUsersAndMembers(t *testing.T) {
+	const adminToken = "admin-token"
+	const sharedFeed = "shared"
+
+	t.Cleanup(func() {
+		os.RemoveAll(path.Join(baseDir, dataDir, sharedFeed))
+		os.Remove(path.Join(baseDir, dataDir, "users.json"))
+	})
+
+	api, err := NewApiHandler(path.Join(baseDir, dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Config.AdminToken = adminToken
+	r := api.GetServer()
+
+	do := func(method string, target string, body string, cookie *http.Cookie) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if strings.HasPrefix(target, "/api/admin") {
+			req.Header.Set("Authorization", "Bearer "+adminToken)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	login := func(name string) *http.Cookie {
+		res := do(http.MethodPost, "/api/login", `{"name":"`+name+`","password":"password"}`, nil)
+		if res.StatusCode != 200 {
+			t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+		}
+		for _, c := range res.Cookies() {
+			if c.Name == sessionCookieName {
+				return c
+			}
+		}
+		t.Fatal("Session cookie is not present in reply")
+		return nil
+	}
+
+	// Anonymous users can't create feeds
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed, "", nil); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	for _, name := range []string{"bob", "carol"} {
+		if res := do(http.MethodPost, "/api/admin/users", `{"name":"`+name+`","password":"password"}`, nil); res.StatusCode != 200 {
+			t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+		}
+	}
+
+	if res := do(http.MethodPost, "/api/admin/users", `{"name":"bob","password":"password"}`, nil); res.StatusCode != 409 {
+		t.Errorf("Expect code 409 but got %d", res.StatusCode)
+	}
+
+	if res := do(http.MethodPost, "/api/login", `{"name":"bob","password":"wrong password"}`, nil); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	bob := login("bob")
+	carol := login("carol")
+
+	// Authenticated users create feeds they own
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed, "", bob); res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed, "", carol); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	// Share with carol as a viewer
+	if res := do(http.MethodPut, "/api/feeds/"+sharedFeed+"/members/carol", `{"role":"viewer"}`, bob); res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	if res := do(http.MethodPut, "/api/feeds/"+sharedFeed+"/members/bob", `{"role":"viewer"}`, bob); res.StatusCode != 400 {
+		t.Errorf("Expect code 400 but got %d", res.StatusCode)
+	}
+
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed, "", carol); res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// Viewers can't manage members
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed+"/members", "", carol); res.StatusCode != 403 {
+		t.Errorf("Expect code 403 but got %d", res.StatusCode)
+	}
+
+	res := do(http.MethodGet, "/api/me/feeds", "", carol)
+	var feeds []feed.UserFeed
+	if err = json.NewDecoder(res.Body).Decode(&feeds); err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].Name != sharedFeed || feeds[0].Role != feed.RoleViewer {
+		t.Errorf("Unexpected feeds for carol: %v", feeds)
+	}
+
+	// Removed members lose access
+	if res := do(http.MethodDelete, "/api/feeds/"+sharedFeed+"/members/carol", "", bob); res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed, "", carol); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+
+	// Changing password requires the current one and ends other sessions
+	carol2 := login("carol")
+	if res := do(http.MethodPost, "/api/me/password", `{"current":"wrong password","password":"new password"}`, carol); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+	res = do(http.MethodPost, "/api/me/password", `{"current":"password","password":"new password"}`, carol)
+	if res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	renewed := res.Cookies()
+	if len(renewed) != 1 || renewed[0].Name != sessionCookieName {
+		t.Fatalf("Expect session cookie to be renewed")
+	}
+	if res := do(http.MethodGet, "/api/me", "", carol2); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+	if res := do(http.MethodGet, "/api/me", "", renewed[0]); res.StatusCode != 200 {
+		t.Errorf("Expect code 200 but got %d", res.StatusCode)
+	}
+
+	// Deleted users lose their sessions and feeds, even if a user with the
+	// same name is created again
+	if res := do(http.MethodDelete, "/api/admin/users/bob", "", nil); res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	if res := do(http.MethodGet, "/api/me", "", bob); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+	if res := do(http.MethodPost, "/api/admin/users", `{"name":"bob","password":"password"}`, nil); res.StatusCode != 200 {
+		t.Fatalf("Expect code 200 but got %d", res.StatusCode)
+	}
+	if res := do(http.MethodGet, "/api/me", "", bob); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+	if res := do(http.MethodGet, "/api/feeds/"+sharedFeed, "", login("bob")); res.StatusCode != 401 {
+		t.Errorf("Expect code 401 but got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,91 @@
+package users
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// SessionManager keeps the session generation of users authenticated by an
+// external provider, like OpenID Connect, which have no local account.
+// Sessions are bound to the generation of the user, and end when it is
+// revoked.
+type SessionManager struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewSessionManager returns a SessionManager storing generations in file at
+// path
+func NewSessionManager(path string) *SessionManager {
+	return &SessionManager{
+		path: path,
+	}
+}
+
+// read returns the generations of all users from file
+func (m *SessionManager) read() (map[string]int64, error) {
+	result := map[string]int64{}
+
+	b, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("%w: %s", UserErrorInvalidFile, m.path)
+	}
+
+	return result, nil
+}
+
+// Generation returns the session generation of user, which is 0 until their
+// sessions are revoked
+func (m *SessionManager) Generation(user string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	generations, err := m.read()
+	if err != nil {
+		return 0, err
+	}
+
+	return generations[user], nil
+}
+
+// Revoke ends all sessions of user by changing their generation
+func (m *SessionManager) Revoke(user string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	generations, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	generation := time.Now().UnixNano()
+	if generation <= generations[user] {
+		generation = generations[user] + 1
+	}
+	generations[user] = generation
+
+	b, err := json.MarshalIndent(generations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(m.path, b, 0600); err != nil {
+		return fmt.Errorf("%w: %s", UserErrorCantWrite, m.path)
+	}
+
+	uL.Logger.Info("Revoked sessions", slog.String("user", user))
+
+	return nil
+}
@@ -0,0 +1,278 @@
+// Package users implements local user accounts, stored with hashed
+// passwords in ybFeed data directory.
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ybizeul/ybfeed/pkg/yblog"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/exp/slog"
+)
+
+// uL is a logger for user management activity
+var uL = yblog.NewYBLogger("users", []string{"DEBUG", "DEBUG_USERS"})
+
+// MinPasswordLength is the minimum length of a user password
+const MinPasswordLength = 8
+
+// validName matches allowed user names. Names can't contain "@" or "#" so
+// they never collide with users authenticated with OpenID Connect.
+var validName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// Errors related to users
+var (
+	UserErrorNotFound          = errors.New("user not found")
+	UserErrorAlreadyExists     = errors.New("user already exists")
+	UserErrorInvalidName       = errors.New("invalid user name")
+	UserErrorPasswordTooShort  = fmt.Errorf("password should be at least %d characters", MinPasswordLength)
+	UserErrorInvalidCredential = errors.New("invalid user name or password")
+	UserErrorCantWrite         = errors.New("can't write users file")
+	UserErrorInvalidFile       = errors.New("users file invalid")
+)
+
+// dummyHash is compared to passwords of unknown users
+var dummyHash []byte
+var dummyHashOnce sync.Once
+
+// User is a local account. Sessions are bound to Generation, which changes
+// when the password changes. It starts from the creation time so that a user
+// deleted and created again never matches sessions of the previous one.
+type User struct {
+	Name         string    `json:"name"`
+	PasswordHash string    `json:"passwordhash"`
+	Created      time.Time `json:"created"`
+	Generation   int64     `json:"generation"`
+}
+
+// UserManager manages local user accounts stored in a json file
+type UserManager struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewUserManager returns a UserManager storing users in file at path
+func NewUserManager(path string) *UserManager {
+	return &UserManager{
+		path: path,
+	}
+}
+
+// read returns all users from file
+func (m *UserManager) read() (map[string]*User, error) {
+	result := map[string]*User{}
+
+	b, err := os.ReadFile(m.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &result); err != nil {
+		return nil, fmt.Errorf("%w: %s", UserErrorInvalidFile, m.path)
+	}
+
+	return result, nil
+}
+
+// write saves all users to file
+func (m *UserManager) write(users map[string]*User) error {
+	b, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(m.path, b, 0600); err != nil {
+		return fmt.Errorf("%w: %s", UserErrorCantWrite, m.path)
+	}
+
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of password
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", UserErrorPasswordTooShort
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// Create adds a new user with name and password
+func (m *UserManager) Create(name string, password string) (*User, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("%w: %s", UserErrorInvalidName, name)
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	users, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := users[name]; ok {
+		return nil, fmt.Errorf("%w: %s", UserErrorAlreadyExists, name)
+	}
+
+	now := time.Now()
+	user := &User{
+		Name:         name,
+		PasswordHash: hash,
+		Created:      now,
+		Generation:   now.UnixNano(),
+	}
+	users[name] = user
+
+	if err = m.write(users); err != nil {
+		return nil, err
+	}
+
+	uL.Logger.Info("Created user", slog.String("user", name))
+
+	return user, nil
+}
+
+// Get returns the user with name
+func (m *UserManager) Get(name string) (*User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	users, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+
+	user, ok := users[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", UserErrorNotFound, name)
+	}
+
+	return user, nil
+}
+
+// List returns the names of all users, sorted alphabetically
+func (m *UserManager) List() ([]string, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	users, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+	for name := range users {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// Delete removes the user with name
+func (m *UserManager) Delete(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	users, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := users[name]; !ok {
+		return fmt.Errorf("%w: %s", UserErrorNotFound, name)
+	}
+
+	delete(users, name)
+
+	return m.write(users)
+}
+
+// SetPassword changes the password of the user with name, which ends their
+// existing sessions
+func (m *UserManager) SetPassword(name string, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	users, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	user, ok := users[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", UserErrorNotFound, name)
+	}
+
+	user.PasswordHash = hash
+	user.Generation++
+
+	return m.write(users)
+}
+
+// RevokeSessions ends the existing sessions of the user with name
+func (m *UserManager) RevokeSessions(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	users, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	user, ok := users[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", UserErrorNotFound, name)
+	}
+
+	user.Generation++
+
+	return m.write(users)
+}
+
+// Authenticate returns the user with name if password is correct
+func (m *UserManager) Authenticate(name string, password string) (*User, error) {
+	user, err := m.Get(name)
+	if err != nil {
+		if errors.Is(err, UserErrorNotFound) {
+			// Spend the same time as for a real user to avoid disclosing
+			// which users exist
+			dummyHashOnce.Do(func() {
+				dummyHash, _ = bcrypt.GenerateFromPassword([]byte("ybFeed"), bcrypt.DefaultCost)
+			})
+			_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+			return nil, UserErrorInvalidCredential
+		}
+		return nil, err
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, UserErrorInvalidCredential
+	}
+
+	return user, nil
+}
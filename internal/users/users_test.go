@@ -0,0 +1,106 @@
+package users
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestUserManager(t *testing.T) {
+	m := NewUserManager(path.Join(t.TempDir(), "users.json"))
+
+	if _, err := m.Create("alice@example.com", "password"); !errors.Is(err, UserErrorInvalidName) {
+		t.Errorf("Expect %v but got %v", UserErrorInvalidName, err)
+	}
+
+	if _, err := m.Create("alice", "short"); !errors.Is(err, UserErrorPasswordTooShort) {
+		t.Errorf("Expect %v but got %v", UserErrorPasswordTooShort, err)
+	}
+
+	u, err := m.Create("alice", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.PasswordHash == "password" {
+		t.Errorf("Password is stored in clear")
+	}
+
+	if _, err = m.Create("alice", "password"); !errors.Is(err, UserErrorAlreadyExists) {
+		t.Errorf("Expect %v but got %v", UserErrorAlreadyExists, err)
+	}
+
+	if _, err = m.Authenticate("alice", "password"); err != nil {
+		t.Errorf("Expect successful authentication but got %v", err)
+	}
+
+	if _, err = m.Authenticate("alice", "wrong password"); !errors.Is(err, UserErrorInvalidCredential) {
+		t.Errorf("Expect %v but got %v", UserErrorInvalidCredential, err)
+	}
+
+	if _, err = m.Authenticate("bob", "password"); !errors.Is(err, UserErrorInvalidCredential) {
+		t.Errorf("Expect %v but got %v", UserErrorInvalidCredential, err)
+	}
+
+	if err = m.SetPassword("alice", "new password"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := m.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed.Generation == u.Generation {
+		t.Errorf("Expect generation to change with password")
+	}
+
+	if err = m.RevokeSessions("alice"); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := m.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.Generation == changed.Generation {
+		t.Errorf("Expect generation to change when sessions are revoked")
+	}
+
+	if _, err = m.Authenticate("alice", "new password"); err != nil {
+		t.Errorf("Expect successful authentication but got %v", err)
+	}
+
+	if err = m.Delete("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("Expect no users but got %v", names)
+	}
+}
+
+func TestSessionManager(t *testing.T) {
+	m := NewSessionManager(path.Join(t.TempDir(), "sessions.json"))
+
+	g, err := m.Generation("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g != 0 {
+		t.Errorf("Expect generation 0 but got %d", g)
+	}
+
+	if err = m.Revoke("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := m.Generation("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked == g {
+		t.Errorf("Expect generation to change when sessions are revoked")
+	}
+}
@@ -0,0 +1,194 @@
+// Package client implements a client for the ybFeed API, to read and write
+// feeds on a remote server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Errors returned by the client, matched with errors.Is
+var (
+	ErrorUnauthorized = errors.New("unauthorized")
+	ErrorForbidden    = errors.New("forbidden")
+	ErrorNotFound     = errors.New("not found")
+	ErrorBadRequest   = errors.New("bad request")
+	ErrorConflict     = errors.New("conflict")
+	ErrorServer       = errors.New("server error")
+)
+
+// Error is returned when the server replies with an unexpected status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Unwrap returns the generic error matching the status code
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrorUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrorForbidden
+	case e.StatusCode == http.StatusNotFound, e.StatusCode == http.StatusGone:
+		return ErrorNotFound
+	case e.StatusCode == http.StatusConflict:
+		return ErrorConflict
+	case e.StatusCode >= 500:
+		return ErrorServer
+	default:
+		return ErrorBadRequest
+	}
+}
+
+// Client sends requests to the ybFeed server at Server, authenticated with
+// Secret, which is a feed secret, a token or a PIN. AdminToken is only needed
+// for the admin API. A session started with Login is kept by HTTPClient.
+type Client struct {
+	Server     string
+	Secret     string
+	AdminToken string
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the server at URL server using secret
+func New(server string, secret string) *Client {
+	return &Client{
+		Server:     strings.TrimSuffix(server, "/"),
+		Secret:     secret,
+		HTTPClient: &http.Client{Jar: &sessionJar{}},
+	}
+}
+
+// sessionCookieName is the name of the cookie holding the user session
+const sessionCookieName = "Session"
+
+// sessionJar is a cookie jar that only keeps the session cookie, feed
+// secrets are always sent from Client.Secret
+type sessionJar struct {
+	mutex   sync.Mutex
+	session *http.Cookie
+}
+
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	for _, c := range cookies {
+		if c.Name != sessionCookieName {
+			continue
+		}
+		if c.MaxAge < 0 || c.Value == "" {
+			j.session = nil
+			continue
+		}
+		j.session = &http.Cookie{Name: c.Name, Value: c.Value}
+	}
+}
+
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if j.session == nil {
+		return nil
+	}
+	return []*http.Cookie{j.session}
+}
+
+// feedPath returns the API path for feedName followed by elements. Path
+// elements are query escaped, as the server query unescapes them.
+func feedPath(feedName string, elements ...string) string {
+	p := "/api/feeds/" + url.QueryEscape(feedName)
+	for _, e := range elements {
+		p += "/" + url.QueryEscape(e)
+	}
+	return p
+}
+
+// newRequest returns an authenticated request for path p on the server
+func (c *Client) newRequest(ctx context.Context, method string, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.Server+p, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Secret != "" {
+		req.AddCookie(&http.Cookie{Name: "Secret", Value: c.Secret})
+	}
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+	return req, nil
+}
+
+// do sends req and returns the response, or an *Error if the status isn't
+// successful
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return nil, &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(b))}
+	}
+
+	return res, nil
+}
+
+// doJSON sends req and decodes the json response in v, if v isn't nil
+func (c *Client) doJSON(req *http.Request, v any) error {
+	res, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if v == nil {
+		_, err = io.Copy(io.Discard, res.Body)
+		return err
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// newJSONRequest returns an authenticated request with v as json body
+func (c *Client) newJSONRequest(ctx context.Context, method string, p string, v any) (*http.Request, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.newRequest(ctx, method, p, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// Result is the reply of requests that don't return an object
+type Result struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Ping checks that the server is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api", nil)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, nil)
+}
@@ -0,0 +1,619 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ybizeul/ybfeed/internal/handlers"
+)
+
+const testAdminToken = "admin token"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	api, err := handlers.NewApiHandler(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.AnonymousFeeds = true
+	api.MaxBodySize = 5 * 1024 * 1024
+	api.Config.AdminToken = testAdminToken
+	server := httptest.NewServer(api.GetServer())
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestPushPullRemove(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	// Creating the feed returns the secret
+	f, err := New(server.URL, "").GetFeed(ctx, "client feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Secret == "" {
+		t.Fatal("Expect secret for new feed")
+	}
+
+	c := New(server.URL, f.Secret)
+
+	if err = c.AddItem(ctx, "client feed", "text/plain", "", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.AddItem(ctx, "client feed", "application/octet-stream", "build+1.log", strings.NewReader("log")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err = c.GetFeed(ctx, "client feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Items) != 2 {
+		t.Fatalf("Expect 2 items but got %v", f.Items)
+	}
+
+	r, err := c.GetItem(ctx, "client feed", "build+1.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "log" {
+		t.Errorf("Expect content log but got %s", string(b))
+	}
+
+	if err = c.DeleteItem(ctx, "client feed", "Pasted Text.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.DeleteItem(ctx, "client feed", "Pasted Text.txt"); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("Expect %v but got %v", ErrorNotFound, err)
+	}
+
+	_, err = New(server.URL, "foo").GetFeed(ctx, "client feed")
+	if !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+}
+
+func TestFeedManagement(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	f, err := New(server.URL, "").CreateFeed(ctx, FeedOptions{
+		Name:        "managed",
+		Description: "Managed feed",
+		Retention:   "24h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Secret == "" || f.Retention != (24*time.Hour).String() || f.Description != "Managed feed" {
+		t.Fatalf("Unexpected feed %+v", f)
+	}
+
+	if _, err = New(server.URL, "").CreateFeed(ctx, FeedOptions{Name: "managed"}); !errors.Is(err, ErrorConflict) {
+		t.Errorf("Expect %v but got %v", ErrorConflict, err)
+	}
+
+	c := New(server.URL, f.Secret)
+
+	// Tokens
+	token, err := c.CreateToken(ctx, "managed", "reader", []string{"read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := c.Tokens(ctx, "managed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "reader" {
+		t.Errorf("Unexpected tokens %v", tokens)
+	}
+	reader := New(server.URL, token.Token)
+	if _, err = reader.GetFeed(ctx, "managed"); err != nil {
+		t.Error(err)
+	}
+	if err = reader.AddItem(ctx, "managed", "text/plain", "", strings.NewReader("no")); !errors.Is(err, ErrorForbidden) {
+		t.Errorf("Expect %v but got %v", ErrorForbidden, err)
+	}
+	if err = c.DeleteToken(ctx, "managed", token.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	// PIN
+	if err = c.SetPIN(ctx, "managed", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = New(server.URL, "1234").GetFeed(ctx, "managed"); err != nil {
+		t.Error(err)
+	}
+
+	// Items and links
+	if err = c.AddItem(ctx, "managed", "text/plain", "", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	link, err := c.ItemLink(ctx, "managed", "Pasted Text.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(link.URL, "signature=") || time.Until(link.Expires) > time.Minute {
+		t.Errorf("Unexpected link %+v", link)
+	}
+	if err = c.EmptyFeed(ctx, "managed"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rename and delete
+	f, err = c.RenameFeed(ctx, "managed", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "renamed" || len(f.Items) != 0 {
+		t.Errorf("Unexpected feed %+v", f)
+	}
+	if err = c.DeleteFeed(ctx, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	admin := New(server.URL, "")
+	admin.AdminToken = testAdminToken
+	secrets, err := admin.Secrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 0 {
+		t.Errorf("Expect feed to be deleted but got %v", secrets)
+	}
+}
+
+func TestUsersAndAdmin(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	admin := New(server.URL, "")
+	if _, err := admin.Users(ctx); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+
+	admin.AdminToken = testAdminToken
+	for _, name := range []string{"alice", "bob"} {
+		if err := admin.CreateUser(ctx, name, "password"+name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := admin.Users(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Errorf("Expect 2 users but got %v", names)
+	}
+
+	alice := New(server.URL, "")
+	if err = alice.Login(ctx, "alice", "wrong"); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+	if err = alice.Login(ctx, "alice", "passwordalice"); err != nil {
+		t.Fatal(err)
+	}
+	me, err := alice.Me(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me != "alice" {
+		t.Errorf("Expect alice but got %s", me)
+	}
+
+	if _, err = alice.CreateFeed(ctx, FeedOptions{Name: "shared"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = alice.SetMember(ctx, "shared", "bob", "viewer"); err != nil {
+		t.Fatal(err)
+	}
+	members, err := alice.Members(ctx, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0].User != "bob" || members[0].Role != "viewer" {
+		t.Errorf("Unexpected members %v", members)
+	}
+
+	bob := New(server.URL, "")
+	if err = bob.Login(ctx, "bob", "passwordbob"); err != nil {
+		t.Fatal(err)
+	}
+	feeds, err := bob.MyFeeds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].Name != "shared" || feeds[0].Role != "viewer" {
+		t.Errorf("Unexpected feeds %v", feeds)
+	}
+	if err = alice.RemoveMember(ctx, "shared", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bob.GetFeed(ctx, "shared"); err == nil {
+		t.Error("Expect bob to lose access to feed")
+	}
+
+	if err = bob.ChangePassword(ctx, "wrong", "newpassword"); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+	if err = bob.ChangePassword(ctx, "passwordbob", "newpassword"); err != nil {
+		t.Fatal(err)
+	}
+	if err = bob.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = bob.Me(ctx); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+	if err = bob.Login(ctx, "bob", "newpassword"); err != nil {
+		t.Fatal(err)
+	}
+
+	secrets, err := admin.Secrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 1 || secrets[0].Name != "shared" {
+		t.Errorf("Unexpected secrets %v", secrets)
+	}
+	stats, err := admin.FeedStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Name != "shared" {
+		t.Errorf("Unexpected stats %v", stats)
+	}
+
+	if err = admin.DeleteUser(ctx, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err = admin.DeleteUser(ctx, "bob"); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("Expect %v but got %v", ErrorNotFound, err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server := newTestServer(t)
+
+	f, err := New(server.URL, "").GetFeed(ctx, "subscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(server.URL, f.Secret)
+
+	// The server closes the websocket when the secret is wrong
+	denied, err := New(server.URL, "foo").Subscribe(ctx, "subscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range denied.Notifications() {
+	}
+	if !errors.Is(denied.Err(), ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, denied.Err())
+	}
+
+	s, err := c.Subscribe(ctx, "subscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	next := func() FeedNotification {
+		select {
+		case n, ok := <-s.Notifications():
+			if !ok {
+				t.Fatalf("Subscription ended: %v", s.Err())
+			}
+			return n
+		case <-ctx.Done():
+			t.Fatal("Timeout waiting for notification")
+		}
+		return FeedNotification{}
+	}
+
+	// The server may not have registered the websocket yet
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err = c.AddItem(ctx, "subscribed", "text/plain", "", strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case n := <-s.Notifications():
+			if n.Action != ActionAdd || n.Item.Name != "Pasted Text.txt" {
+				t.Fatalf("Unexpected notification %+v", n)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if time.Now().Before(deadline) {
+				continue
+			}
+			t.Fatal("Timeout waiting for notification")
+		}
+		break
+	}
+
+	devices, err := c.Presence(ctx, "subscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].UserAgent == "" {
+		t.Errorf("Unexpected presence %+v", devices)
+	}
+
+	if err = c.DeleteItem(ctx, "subscribed", "Pasted Text.txt"); err != nil {
+		t.Fatal(err)
+	}
+	removed := next()
+	if removed.Action != ActionRemove {
+		t.Errorf("Expect remove action but got %+v", removed)
+	}
+
+	// Notifications missed while disconnected are sent on resume
+	resumed, err := c.Subscribe(ctx, "subscribed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	if err = resumed.Resume(removed.Seq - 1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-resumed.Notifications():
+		if n.Action != ActionRemove || n.Seq != removed.Seq {
+			t.Errorf("Expect remove action %d but got %+v", removed.Seq, n)
+		}
+	case <-ctx.Done():
+		t.Fatal("Timeout waiting for notification")
+	}
+	resumed.Close()
+
+	// Polling returns the same notifications
+	polled, err := c.Poll(ctx, "subscribed", removed.Seq-1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(polled.Notifications) != 1 || polled.Notifications[0].Seq != removed.Seq || polled.Seq != removed.Seq {
+		t.Errorf("Expect remove notification %d but got %+v", removed.Seq, polled)
+	}
+
+	description := "Shared notes"
+	if _, err = c.UpdateSettings(ctx, "subscribed", SettingsUpdate{Description: &description}); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); n.Action != ActionSettings || n.Settings == nil || n.Settings.Description != description {
+		t.Errorf("Expect settings action but got %+v", n)
+	}
+
+	if _, err = c.RenameFeed(ctx, "subscribed", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); n.Action != ActionRenamed || n.Name != "moved" {
+		t.Errorf("Expect renamed action but got %+v", n)
+	}
+
+	if err = c.DeleteFeed(ctx, "moved"); err != nil {
+		t.Fatal(err)
+	}
+	for range s.Notifications() {
+	}
+	if !errors.Is(s.Err(), ErrorNotFound) {
+		t.Errorf("Expect subscription to end with feed deletion but got %v", s.Err())
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server := newTestServer(t)
+
+	f, err := New(server.URL, "").GetFeed(ctx, "streamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(server.URL, f.Secret)
+
+	if _, err = New(server.URL, "foo").Events(ctx, "streamed", 0); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+
+	e, err := c.Events(ctx, "streamed", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	next := func(e *EventStream) FeedNotification {
+		select {
+		case n, ok := <-e.Notifications():
+			if !ok {
+				t.Fatalf("Event stream ended: %v", e.Err())
+			}
+			return n
+		case <-ctx.Done():
+			t.Fatal("Timeout waiting for notification")
+		}
+		return FeedNotification{}
+	}
+
+	if err = c.AddItem(ctx, "streamed", "text/plain", "", strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	added := next(e)
+	if added.Action != ActionAdd || added.Item.Name != "Pasted Text.txt" {
+		t.Fatalf("Unexpected notification %+v", added)
+	}
+	if e.LastID() != added.Seq {
+		t.Errorf("Expect last id %d but got %d", added.Seq, e.LastID())
+	}
+	e.Close()
+
+	// Notifications missed while disconnected are sent on reconnection
+	if err = c.DeleteItem(ctx, "streamed", "Pasted Text.txt"); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := c.Events(ctx, "streamed", e.LastID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resumed.Close()
+	if n := next(resumed); n.Action != ActionRemove || n.Seq != added.Seq+1 {
+		t.Errorf("Expect remove action %d but got %+v", added.Seq+1, n)
+	}
+}
+
+func TestSubscriptionCommands(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server := newTestServer(t)
+
+	f, err := New(server.URL, "").GetFeed(ctx, "commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(server.URL, f.Secret)
+
+	s, err := c.Subscribe(ctx, "commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Commands don't wait for notifications to be read
+	item, err := s.AddText(ctx, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "Pasted Text.txt" || item.Type != Text {
+		t.Errorf("Unexpected item %+v", item)
+	}
+
+	page, err := s.Items(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 || page.Items[0].Name != item.Name {
+		t.Errorf("Unexpected items %+v", page)
+	}
+
+	if err = s.SetPIN(ctx, "12"); !errors.Is(err, ErrorBadRequest) {
+		t.Errorf("Expect %v but got %v", ErrorBadRequest, err)
+	}
+	if err = s.SetPIN(ctx, "1234"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = s.DeleteItem(ctx, item.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.DeleteItem(ctx, item.Name); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("Expect %v but got %v", ErrorNotFound, err)
+	}
+
+	if n := <-s.Notifications(); n.Action != ActionAdd || n.Item.Name != item.Name {
+		t.Errorf("Expect add action but got %+v", n)
+	}
+
+	// Commands are limited to the scopes of the secret
+	token, err := c.CreateToken(ctx, "commands", "reader", []string{"read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := New(server.URL, token.Token).Subscribe(ctx, "commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err = reader.AddText(ctx, "hello"); !errors.Is(err, ErrorForbidden) {
+		t.Errorf("Expect %v but got %v", ErrorForbidden, err)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server := newTestServer(t)
+
+	secrets := map[string]string{}
+	for _, name := range []string{"first", "second"} {
+		f, err := New(server.URL, "").GetFeed(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[name] = f.Secret
+	}
+
+	c := New(server.URL, "")
+	s, err := c.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err = s.Subscribe(ctx, "second", "foo", 0); !errors.Is(err, ErrorUnauthorized) {
+		t.Errorf("Expect %v but got %v", ErrorUnauthorized, err)
+	}
+	if _, err = s.Items(ctx, "second", 0, 0); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("Expect %v but got %v", ErrorNotFound, err)
+	}
+
+	for name, secret := range secrets {
+		r, err := s.Subscribe(ctx, name, secret, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Feed != name || len(r.Scopes) == 0 {
+			t.Errorf("Unexpected subscription %+v", r)
+		}
+	}
+	if _, err = s.Subscribe(ctx, "first", secrets["first"], 0); !errors.Is(err, ErrorConflict) {
+		t.Errorf("Expect %v but got %v", ErrorConflict, err)
+	}
+
+	next := func() FeedNotification {
+		select {
+		case n, ok := <-s.Notifications():
+			if !ok {
+				t.Fatalf("Socket closed: %v", s.Err())
+			}
+			return n
+		case <-ctx.Done():
+			t.Fatal("Timeout waiting for notification")
+		}
+		return FeedNotification{}
+	}
+
+	// Notifications are tagged with the feed name
+	if _, err = s.AddText(ctx, "second", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); n.Feed != "second" || n.Action != ActionAdd {
+		t.Errorf("Expect add action on second but got %+v", n)
+	}
+
+	if err = s.Unsubscribe(ctx, "first"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.AddText(ctx, "first", "hello"); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("Expect %v but got %v", ErrorNotFound, err)
+	}
+
+	// Deleted feeds are closed without closing the websocket
+	if err = New(server.URL, secrets["second"]).DeleteFeed(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if n := next(); n.Feed != "second" || n.Action != ActionClosed || n.Code == 0 {
+		t.Errorf("Expect closed action on second but got %+v", n)
+	}
+	if _, err = s.Items(ctx, "second", 0, 0); !errors.Is(err, ErrorNotFound) {
+		t.Errorf("Expect %v but got %v", ErrorNotFound, err)
+	}
+}
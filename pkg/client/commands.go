@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Commands sent as JSON messages on websockets
+const (
+	commandAdd    = "add"
+	commandDelete = "delete"
+	commandPIN    = "pin"
+	commandItems  = "items"
+
+	commandSubscribe   = "subscribe"
+	commandUnsubscribe = "unsubscribe"
+)
+
+// command is a request sent on a websocket, ID is echoed in the response
+type command struct {
+	ID      string  `json:"id"`
+	Command string  `json:"command"`
+	Feed    string  `json:"feed,omitempty"`
+	Secret  string  `json:"secret,omitempty"`
+	Since   *uint64 `json:"since,omitempty"`
+	Text    string  `json:"text,omitempty"`
+	Item    string  `json:"item,omitempty"`
+	PIN     string  `json:"pin,omitempty"`
+	Offset  int     `json:"offset,omitempty"`
+	Limit   int     `json:"limit,omitempty"`
+}
+
+// commandError is the error of a failed command, Code follows HTTP status
+// codes
+type commandError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// message is received on a websocket, either a notification or the
+// response to a command when Command is set
+type message struct {
+	FeedNotification
+	ID      string          `json:"id"`
+	Command string          `json:"command"`
+	Result  json.RawMessage `json:"result"`
+	Error   *commandError   `json:"error"`
+}
+
+// ItemsPage is a page of items returned by Items, most recent first. Total
+// is the number of items in the feed.
+type ItemsPage struct {
+	Items  []Item `json:"items"`
+	Offset int    `json:"offset"`
+	Total  int    `json:"total"`
+}
+
+// itemResult is the result of the add and delete commands
+type itemResult struct {
+	Item *Item `json:"item"`
+}
+
+// do sends cmd and waits for its response. The result is decoded in result,
+// if it isn't nil, and failed commands return an *Error.
+func (s *socket) do(ctx context.Context, cmd command, result any) error {
+	response := make(chan message, 1)
+
+	s.mutex.Lock()
+	s.lastID++
+	cmd.ID = strconv.FormatUint(s.lastID, 10)
+	s.pending[cmd.ID] = response
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.pending, cmd.ID)
+		s.mutex.Unlock()
+	}()
+
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if err = s.write(b); err != nil {
+		return err
+	}
+
+	select {
+	case m := <-response:
+		if m.Error != nil {
+			return &Error{StatusCode: m.Error.Code, Message: m.Error.Message}
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(m.Result, result)
+	case <-s.done:
+		if err = s.Err(); err != nil {
+			return err
+		}
+		return errors.New("connection closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// addText runs the add command on feed feedName
+func (s *socket) addText(ctx context.Context, feedName string, text string) (*Item, error) {
+	var r itemResult
+	if err := s.do(ctx, command{Command: commandAdd, Feed: feedName, Text: text}, &r); err != nil {
+		return nil, err
+	}
+	return r.Item, nil
+}
+
+// deleteItem runs the delete command on feed feedName
+func (s *socket) deleteItem(ctx context.Context, feedName string, itemName string) (*Item, error) {
+	var r itemResult
+	if err := s.do(ctx, command{Command: commandDelete, Feed: feedName, Item: itemName}, &r); err != nil {
+		return nil, err
+	}
+	return r.Item, nil
+}
+
+// setPIN runs the pin command on feed feedName
+func (s *socket) setPIN(ctx context.Context, feedName string, pin string) error {
+	return s.do(ctx, command{Command: commandPIN, Feed: feedName, PIN: pin}, nil)
+}
+
+// items runs the items command on feed feedName
+func (s *socket) items(ctx context.Context, feedName string, offset int, limit int) (*ItemsPage, error) {
+	var r ItemsPage
+	if err := s.do(ctx, command{Command: commandItems, Feed: feedName, Offset: offset, Limit: limit}, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// AddText adds a text item to the feed, it needs the write scope
+func (s *Subscription) AddText(ctx context.Context, text string) (*Item, error) {
+	return s.addText(ctx, "", text)
+}
+
+// DeleteItem removes item itemName from the feed, it needs the delete scope
+func (s *Subscription) DeleteItem(ctx context.Context, itemName string) (*Item, error) {
+	return s.deleteItem(ctx, "", itemName)
+}
+
+// SetPIN sets a temporary PIN on the feed, it needs the admin scope
+func (s *Subscription) SetPIN(ctx context.Context, pin string) error {
+	return s.setPIN(ctx, "", pin)
+}
+
+// Items returns up to limit items of the feed starting at offset, or the
+// server default number of items when limit is zero
+func (s *Subscription) Items(ctx context.Context, offset int, limit int) (*ItemsPage, error) {
+	return s.items(ctx, "", offset, limit)
+}
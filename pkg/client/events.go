@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EventStream receives notifications for a feed as server-sent events, an
+// alternative to Subscribe for networks blocking websockets
+type EventStream struct {
+	body          io.ReadCloser
+	notifications chan FeedNotification
+
+	mutex  sync.Mutex
+	err    error
+	lastID uint64
+	closed bool
+}
+
+// Events opens a server-sent events stream for feed feedName. When since
+// isn't zero, notifications following sequence since are sent first, or an
+// ActionResync notification when they are not available anymore.
+// Notifications are received until ctx is done, Close is called or the
+// connection is lost.
+func (c *Client) Events(ctx context.Context, feedName string, since uint64) (*EventStream, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName, "events"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if since != 0 {
+		req.Header.Set("Last-Event-ID", strconv.FormatUint(since, 10))
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &EventStream{
+		body:          res.Body,
+		notifications: make(chan FeedNotification),
+		lastID:        since,
+	}
+
+	go e.run(ctx)
+
+	return e, nil
+}
+
+// run reads events until the stream is closed
+func (e *EventStream) run(ctx context.Context) {
+	defer close(e.notifications)
+	defer e.body.Close()
+
+	scanner := bufio.NewScanner(e.body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data strings.Builder
+	var id uint64
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch {
+		case line == "":
+			// A blank line dispatches the event
+			if data.Len() == 0 {
+				continue
+			}
+			var n FeedNotification
+			err := json.Unmarshal([]byte(data.String()), &n)
+			data.Reset()
+			if err != nil || n.Action == "" {
+				id = 0
+				continue
+			}
+			// Events received after Close are not delivered, and don't
+			// count when resuming
+			e.mutex.Lock()
+			if e.closed {
+				e.mutex.Unlock()
+				return
+			}
+			if id != 0 {
+				e.lastID = id
+				id = 0
+			}
+			e.mutex.Unlock()
+			select {
+			case e.notifications <- n:
+			case <-ctx.Done():
+				e.setErr(ctx.Err())
+				return
+			}
+		case field == "":
+			// Comment, sent by the server to keep the connection alive
+		case field == "id":
+			id, _ = strconv.ParseUint(value, 10, 64)
+		case field == "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		e.setErr(err)
+		return
+	}
+	e.setErr(io.EOF)
+}
+
+// setErr records the error that ended the stream
+func (e *EventStream) setErr(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Notifications returns the channel receiving notifications. It is closed
+// when the stream ends, Err then returns the reason.
+func (e *EventStream) Notifications() <-chan FeedNotification {
+	return e.notifications
+}
+
+// LastID returns the sequence of the last notification received, to pass
+// to Events when reconnecting
+func (e *EventStream) LastID() uint64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.lastID
+}
+
+// Err returns the error that ended the stream, if any
+func (e *EventStream) Err() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.err
+}
+
+// Close ends the stream
+func (e *EventStream) Close() error {
+	e.setErr(errors.New("event stream closed"))
+	e.mutex.Lock()
+	e.closed = true
+	e.mutex.Unlock()
+	return e.body.Close()
+}
@@ -0,0 +1,421 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ItemType is the type of an item in a feed
+type ItemType int
+
+const (
+	Text ItemType = iota
+	Image
+	Binary
+)
+
+// Item is an item in a feed
+type Item struct {
+	Name string    `json:"name"`
+	Date time.Time `json:"date"`
+	Type ItemType  `json:"type"`
+}
+
+// Feed is a feed and its items, most recent first
+type Feed struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	Retention      string   `json:"retention,omitempty"`
+	Items          []Item   `json:"items"`
+	Secret         string   `json:"secret,omitempty"`
+	Scopes         []string `json:"scopes,omitempty"`
+	VAPIDPublicKey string   `json:"vapidpublickey,omitempty"`
+}
+
+// FeedOptions are the settings of a feed created with CreateFeed. Retention
+// is a duration like "24h", items are kept forever when it is empty.
+type FeedOptions struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Retention   string `json:"retention,omitempty"`
+}
+
+// FeedSettings is the configuration of a feed, sent in settings
+// notifications. PINExpiration is set while a PIN is valid.
+type FeedSettings struct {
+	Description   string     `json:"description,omitempty"`
+	Retention     string     `json:"retention,omitempty"`
+	PINExpiration *time.Time `json:"pinexpiration,omitempty"`
+	Subscriptions int        `json:"subscriptions"`
+}
+
+// SettingsUpdate changes the description and retention of a feed with
+// UpdateSettings. Nil fields are left unchanged.
+type SettingsUpdate struct {
+	Description *string `json:"description,omitempty"`
+	Retention   *string `json:"retention,omitempty"`
+}
+
+// Member is a user a feed is shared with
+type Member struct {
+	User string `json:"user"`
+	Role string `json:"role"`
+}
+
+// Token is an access token to a feed, limited to Scopes
+type Token struct {
+	Token  string   `json:"token"`
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+// PushSubscription is a web push subscription, as returned by the browser
+// push manager
+type PushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		Auth   string `json:"auth"`
+		P256dh string `json:"p256dh"`
+	} `json:"keys"`
+}
+
+// SignedLink is a link to an item that can be used without authentication
+// until Expires
+type SignedLink struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// Device is a client connected to a feed with a websocket or an event
+// stream
+type Device struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	UserAgent string    `json:"useragent,omitempty"`
+	Connected time.Time `json:"connected"`
+}
+
+// GetFeed returns feed feedName with its items
+func (c *Client) GetFeed(ctx context.Context, feedName string) (*Feed, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Feed
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// CreateFeed creates a new feed and returns it with its secret. The client
+// secret isn't changed.
+func (c *Client) CreateFeed(ctx context.Context, options FeedOptions) (*Feed, error) {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, "/api/feeds/", options)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Feed
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DeleteFeed removes feed feedName and all its items
+func (c *Client) DeleteFeed(ctx context.Context, feedName string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, feedPath(feedName), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// RenameFeed renames feed feedName to newName and returns the renamed feed
+func (c *Client) RenameFeed(ctx context.Context, feedName string, newName string) (*Feed, error) {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, feedPath(feedName, "rename"), struct {
+		Name string `json:"name"`
+	}{Name: newName})
+	if err != nil {
+		return nil, err
+	}
+
+	var result Feed
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// SetPIN sets a temporary PIN that can be used as secret on feed feedName
+func (c *Client) SetPIN(ctx context.Context, feedName string, pin string) error {
+	req, err := c.newRequest(ctx, http.MethodPatch, feedPath(feedName), strings.NewReader(pin))
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// ClaimFeed makes the logged in user the owner of feed feedName
+func (c *Client) ClaimFeed(ctx context.Context, feedName string) error {
+	req, err := c.newRequest(ctx, http.MethodPost, feedPath(feedName, "owner"), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// TransferFeed makes user the owner of feed feedName, which must be owned by
+// the logged in user
+func (c *Client) TransferFeed(ctx context.Context, feedName string, user string) error {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, feedPath(feedName, "owner"), struct {
+		User string `json:"user"`
+	}{User: user})
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// AddPushSubscription registers s to receive web push notifications for
+// feed feedName
+func (c *Client) AddPushSubscription(ctx context.Context, feedName string, s PushSubscription) error {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, feedPath(feedName, "subscription"), s)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// RemovePushSubscription stops web push notifications to s for feed
+// feedName
+func (c *Client) RemovePushSubscription(ctx context.Context, feedName string, s PushSubscription) error {
+	req, err := c.newJSONRequest(ctx, http.MethodDelete, feedPath(feedName, "subscription"), s)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// UpdateSettings changes the settings of feed feedName and returns them
+func (c *Client) UpdateSettings(ctx context.Context, feedName string, u SettingsUpdate) (*FeedSettings, error) {
+	req, err := c.newJSONRequest(ctx, http.MethodPatch, feedPath(feedName, "settings"), u)
+	if err != nil {
+		return nil, err
+	}
+
+	var result FeedSettings
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// Presence returns the devices connected to feed feedName
+func (c *Client) Presence(ctx context.Context, feedName string) ([]Device, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName, "presence"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Device
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Members returns the users feed feedName is shared with
+func (c *Client) Members(ctx context.Context, feedName string) ([]Member, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName, "members"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Member
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SetMember shares feed feedName with user with role viewer, contributor
+// or admin
+func (c *Client) SetMember(ctx context.Context, feedName string, user string, role string) error {
+	req, err := c.newJSONRequest(ctx, http.MethodPut, feedPath(feedName, "members", user), struct {
+		Role string `json:"role"`
+	}{Role: role})
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// RemoveMember stops sharing feed feedName with user
+func (c *Client) RemoveMember(ctx context.Context, feedName string, user string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, feedPath(feedName, "members", user), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// Tokens returns the access tokens of feed feedName
+func (c *Client) Tokens(ctx context.Context, feedName string) ([]Token, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName, "tokens"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Token
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CreateToken returns a new access token to feed feedName limited to
+// scopes
+func (c *Client) CreateToken(ctx context.Context, feedName string, name string, scopes []string) (*Token, error) {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, feedPath(feedName, "tokens"), Token{
+		Name:   name,
+		Scopes: scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result Token
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// DeleteToken revokes access token token of feed feedName
+func (c *Client) DeleteToken(ctx context.Context, feedName string, token string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, feedPath(feedName, "tokens", token), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// AddItem adds the content read from r to feed feedName. The server names
+// the item after contentType for text and images, or after fileName
+// otherwise.
+func (c *Client) AddItem(ctx context.Context, feedName string, contentType string, fileName string, r io.Reader) error {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+
+	h := textproto.MIMEHeader{}
+	if fileName != "" {
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, fileName))
+	} else {
+		h.Set("Content-Disposition", `form-data; name="file"`)
+	}
+	h.Set("Content-Type", contentType)
+
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(part, r); err != nil {
+		return err
+	}
+	if err = mw.Close(); err != nil {
+		return err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, feedPath(feedName), buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	return c.doJSON(req, nil)
+}
+
+// GetItem returns the content of item itemName in feed feedName. The caller
+// must close the result.
+func (c *Client) GetItem(ctx context.Context, feedName string, itemName string) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName, "items", itemName), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// DeleteItem removes item itemName from feed feedName
+func (c *Client) DeleteItem(ctx context.Context, feedName string, itemName string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, feedPath(feedName, "items", itemName), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// EmptyFeed removes all items from feed feedName
+func (c *Client) EmptyFeed(ctx context.Context, feedName string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, feedPath(feedName, "items"), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// ItemLink returns a signed link to item itemName in feed feedName, valid
+// during ttl, or the server default when ttl is zero
+func (c *Client) ItemLink(ctx context.Context, feedName string, itemName string, ttl time.Duration) (*SignedLink, error) {
+	p := feedPath(feedName, "items", itemName, "link")
+	if ttl > 0 {
+		p += "?" + url.Values{"ttl": {ttl.String()}}.Encode()
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result SignedLink
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+)
+
+// SubscribeResult is returned when subscribing to a feed on a Socket. Seq is
+// the sequence of the last notification of the feed, and Scopes are granted
+// by the secret used to subscribe.
+type SubscribeResult struct {
+	Feed   string   `json:"feed"`
+	Seq    uint64   `json:"seq"`
+	Scopes []string `json:"scopes"`
+}
+
+// Socket is a websocket receiving notifications of several feeds, tagged
+// with their name in FeedNotification.Feed. Commands apply to the feed they
+// are given.
+type Socket struct {
+	*socket
+}
+
+// Connect opens a websocket that can subscribe to several feeds.
+// Notifications are received until ctx is done, Close is called or the
+// connection is lost.
+func (c *Client) Connect(ctx context.Context) (*Socket, error) {
+	s, err := c.dial(ctx, "/ws")
+	if err != nil {
+		return nil, err
+	}
+	return &Socket{socket: s}, nil
+}
+
+// Subscribe starts receiving notifications of feed feedName, with secret
+// being a feed secret, a token or a PIN. It can be empty for feeds of the
+// logged in user. When since isn't zero, notifications following sequence
+// since are sent first, or an ActionResync notification when they are not
+// available anymore.
+func (s *Socket) Subscribe(ctx context.Context, feedName string, secret string, since uint64) (*SubscribeResult, error) {
+	cmd := command{Command: commandSubscribe, Feed: feedName, Secret: secret}
+	if since != 0 {
+		cmd.Since = &since
+	}
+
+	var r SubscribeResult
+	if err := s.do(ctx, cmd, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Unsubscribe stops receiving notifications of feed feedName
+func (s *Socket) Unsubscribe(ctx context.Context, feedName string) error {
+	return s.do(ctx, command{Command: commandUnsubscribe, Feed: feedName}, nil)
+}
+
+// AddText adds a text item to feed feedName, it needs the write scope
+func (s *Socket) AddText(ctx context.Context, feedName string, text string) (*Item, error) {
+	return s.addText(ctx, feedName, text)
+}
+
+// DeleteItem removes item itemName from feed feedName, it needs the delete
+// scope
+func (s *Socket) DeleteItem(ctx context.Context, feedName string, itemName string) (*Item, error) {
+	return s.deleteItem(ctx, feedName, itemName)
+}
+
+// SetPIN sets a temporary PIN on feed feedName, it needs the admin scope
+func (s *Socket) SetPIN(ctx context.Context, feedName string, pin string) error {
+	return s.setPIN(ctx, feedName, pin)
+}
+
+// Items returns up to limit items of feed feedName starting at offset, or
+// the server default number of items when limit is zero
+func (s *Socket) Items(ctx context.Context, feedName string, offset int, limit int) (*ItemsPage, error) {
+	return s.items(ctx, feedName, offset, limit)
+}
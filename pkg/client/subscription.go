@@ -0,0 +1,298 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// Notification actions sent by the server on feed websockets
+const (
+	ActionAdd     = "add"
+	ActionRemove  = "remove"
+	ActionEmpty   = "empty"
+	ActionRenamed = "renamed"
+	ActionResync  = "resync"
+	ActionClosed  = "closed"
+
+	ActionPIN           = "pin"
+	ActionPINExpired    = "pinexpired"
+	ActionSubscriptions = "subscriptions"
+	ActionSettings      = "settings"
+	ActionSecretRotated = "secretrotated"
+)
+
+// FeedNotification is a change in a subscribed feed. Item is set for add
+// and remove actions, Name is the new feed name for renamed action.
+// Settings is set for pin, subscriptions and settings actions. Seq
+// increases with each notification of the feed. Feed is only set on a
+// Socket, and Code and Reason tell why a feed was closed with the closed
+// action.
+type FeedNotification struct {
+	Feed     string        `json:"feed,omitempty"`
+	Action   string        `json:"action"`
+	Item     Item          `json:"item"`
+	Name     string        `json:"name,omitempty"`
+	Settings *FeedSettings `json:"settings,omitempty"`
+	Seq      uint64        `json:"seq,omitempty"`
+	Code     int           `json:"code,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+}
+
+// socket is a websocket to the server. Notifications are queued until they
+// are read from the notifications channel, so responses to commands are
+// received even when notifications aren't read.
+type socket struct {
+	conn          *ws.Conn
+	notifications chan FeedNotification
+	done          chan struct{}
+
+	mutex   sync.Mutex
+	err     error
+	queue   []FeedNotification
+	queued  chan struct{}
+	pending map[string]chan message
+	lastID  uint64
+
+	writeMutex sync.Mutex
+}
+
+// dial opens a websocket to path p on the server, authenticated with the
+// client secret and session
+func (c *Client) dial(ctx context.Context, p string) (*socket, error) {
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+
+	target := strings.TrimSuffix(u.String(), "/") + p
+
+	h := http.Header{}
+	cookies := []string{}
+	if c.Secret != "" {
+		cookies = append(cookies, (&http.Cookie{Name: "Secret", Value: c.Secret}).String())
+	}
+	if c.HTTPClient != nil && c.HTTPClient.Jar != nil {
+		for _, cookie := range c.HTTPClient.Jar.Cookies(u) {
+			cookies = append(cookies, cookie.String())
+		}
+	}
+	if len(cookies) > 0 {
+		h.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	conn, res, err := ws.DefaultDialer.DialContext(ctx, target, h)
+	if err != nil {
+		if res != nil && res.StatusCode != http.StatusSwitchingProtocols {
+			return nil, &Error{StatusCode: res.StatusCode, Message: res.Status}
+		}
+		return nil, err
+	}
+
+	s := &socket{
+		conn:          conn,
+		notifications: make(chan FeedNotification),
+		done:          make(chan struct{}),
+		queued:        make(chan struct{}, 1),
+		pending:       map[string]chan message{},
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.setErr(ctx.Err())
+			conn.Close()
+		case <-s.done:
+		}
+	}()
+
+	go s.run()
+	go s.deliver(ctx)
+
+	return s, nil
+}
+
+// run reads messages until the connection is closed
+func (s *socket) run() {
+	defer close(s.done)
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+
+		var m message
+		if err = json.Unmarshal(data, &m); err != nil {
+			continue
+		}
+
+		switch {
+		case m.Command != "":
+			s.mutex.Lock()
+			response := s.pending[m.ID]
+			s.mutex.Unlock()
+			if response != nil {
+				response <- m
+			}
+		case m.Action != "":
+			s.mutex.Lock()
+			s.queue = append(s.queue, m.FeedNotification)
+			s.mutex.Unlock()
+			select {
+			case s.queued <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// deliver sends queued notifications to the notifications channel, and
+// closes it once the connection is closed and the queue is empty
+func (s *socket) deliver(ctx context.Context) {
+	defer close(s.notifications)
+
+	for {
+		s.mutex.Lock()
+		if len(s.queue) == 0 {
+			s.mutex.Unlock()
+			select {
+			case <-s.queued:
+				continue
+			case <-s.done:
+				s.mutex.Lock()
+				empty := len(s.queue) == 0
+				s.mutex.Unlock()
+				if empty {
+					return
+				}
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		n := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mutex.Unlock()
+
+		select {
+		case s.notifications <- n:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setErr records the error that ended the connection
+func (s *socket) setErr(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return
+	}
+
+	// The server reports feed errors with a close code of 4000 plus the
+	// HTTP status
+	var closeErr *ws.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code >= 4000 && closeErr.Code < 5000 {
+		err = &Error{StatusCode: closeErr.Code - 4000, Message: closeErr.Text}
+	}
+	s.err = err
+}
+
+// write sends data as a text message
+func (s *socket) write(data []byte) error {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	return s.conn.WriteMessage(ws.TextMessage, data)
+}
+
+// Notifications returns the channel receiving notifications. It is closed
+// when the connection ends, Err then returns the reason.
+func (s *socket) Notifications() <-chan FeedNotification {
+	return s.notifications
+}
+
+// Err returns the error that ended the connection, if any
+func (s *socket) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Close ends the connection
+func (s *socket) Close() error {
+	s.setErr(errors.New("subscription closed"))
+	return s.conn.Close()
+}
+
+// Subscription receives notifications for a feed over a websocket, and
+// runs commands on the feed
+type Subscription struct {
+	*socket
+}
+
+// Subscribe opens a websocket to feed feedName. Notifications are received
+// until ctx is done, Close is called or the connection is lost.
+func (c *Client) Subscribe(ctx context.Context, feedName string) (*Subscription, error) {
+	// The server query unescapes the feed name
+	s, err := c.dial(ctx, "/ws/"+url.QueryEscape(feedName))
+	if err != nil {
+		return nil, err
+	}
+	return &Subscription{socket: s}, nil
+}
+
+// Resume asks the server for the notifications following sequence seq,
+// typically the last one received before reconnecting. The server sends an
+// ActionResync notification instead when they are not available anymore.
+func (s *Subscription) Resume(seq uint64) error {
+	return s.write([]byte(fmt.Sprintf("since %d", seq)))
+}
+
+// PollResult holds notifications returned by Poll. Seq is the sequence to
+// poll from next time. When Resync is true, notifications were lost and the
+// feed should be downloaded again.
+type PollResult struct {
+	Seq           uint64             `json:"seq"`
+	Resync        bool               `json:"resync,omitempty"`
+	Notifications []FeedNotification `json:"notifications"`
+}
+
+// Poll returns notifications of feed feedName following sequence since,
+// waiting up to timeout for one, or the server default when timeout is
+// zero. It is an alternative to Subscribe for networks blocking websockets.
+func (c *Client) Poll(ctx context.Context, feedName string, since uint64, timeout time.Duration) (*PollResult, error) {
+	q := url.Values{"since": {strconv.FormatUint(since, 10)}}
+	if timeout > 0 {
+		q.Set("timeout", timeout.String())
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, feedPath(feedName, "poll")+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result PollResult
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// UserFeed is a feed a user owns or is a member of
+type UserFeed struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// FeedSecret is the secret of a feed, as returned by the admin API
+type FeedSecret struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// FeedStats are the usage statistics of a feed, as returned by the admin API
+type FeedStats struct {
+	Name         string    `json:"name"`
+	Items        int       `json:"items"`
+	Bytes        int64     `json:"bytes"`
+	LastActivity time.Time `json:"lastactivity"`
+	Subscribers  int       `json:"subscribers"`
+	WebSockets   int       `json:"websockets"`
+}
+
+// credentials is the body of login requests
+type credentials struct {
+	Name     string `json:"name,omitempty"`
+	Password string `json:"password"`
+}
+
+// userInfo is the reply of requests returning a user
+type userInfo struct {
+	User string `json:"user"`
+}
+
+// Login starts a session for local user name, following requests are sent
+// on behalf of that user
+func (c *Client) Login(ctx context.Context, name string, password string) error {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, "/api/login", credentials{
+		Name:     name,
+		Password: password,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// Logout ends the current session
+func (c *Client) Logout(ctx context.Context) error {
+	req, err := c.newRequest(ctx, http.MethodPost, "/auth/logout", nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// Me returns the name of the user logged in
+func (c *Client) Me(ctx context.Context) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/me", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var result userInfo
+	if err = c.doJSON(req, &result); err != nil {
+		return "", err
+	}
+
+	return result.User, nil
+}
+
+// MyFeeds returns the feeds the user logged in owns or is a member of
+func (c *Client) MyFeeds(ctx context.Context) ([]UserFeed, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/me/feeds", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []UserFeed
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ChangePassword sets the password of the user logged in, current is their
+// current password. Other sessions of the user end.
+func (c *Client) ChangePassword(ctx context.Context, current string, password string) error {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, "/api/me/password", struct {
+		Current  string `json:"current"`
+		Password string `json:"password"`
+	}{Current: current, Password: password})
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// Secrets returns the secrets of all feeds. It requires AdminToken.
+func (c *Client) Secrets(ctx context.Context) ([]FeedSecret, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/admin/secrets", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []FeedSecret
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// FeedStats returns the usage statistics of all feeds. It requires
+// AdminToken.
+func (c *Client) FeedStats(ctx context.Context) ([]FeedStats, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/admin/feeds", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []FeedStats
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Users returns the names of local users. It requires AdminToken.
+func (c *Client) Users(ctx context.Context) ([]string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/api/admin/users", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	if err = c.doJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CreateUser adds local user name. It requires AdminToken.
+func (c *Client) CreateUser(ctx context.Context, name string, password string) error {
+	req, err := c.newJSONRequest(ctx, http.MethodPost, "/api/admin/users", credentials{
+		Name:     name,
+		Password: password,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
+
+// DeleteUser removes local user name. It requires AdminToken.
+func (c *Client) DeleteUser(ctx context.Context, name string) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/api/admin/users/"+url.QueryEscape(name), nil)
+	if err != nil {
+		return err
+	}
+
+	return c.doJSON(req, nil)
+}
@@ -0,0 +1,29 @@
+import { useState } from "react";
+import { Center, Text, TextInput, PasswordInput, Button, Stack } from "@mantine/core";
+import { useFocusTrap } from "@mantine/hooks";
+
+interface LoginRequestProps {
+    message: string;
+    sendLogin: (name: string, password: string) => void;
+}
+
+export function LoginRequest(props:LoginRequestProps) {
+    const { message, sendLogin } = props
+    const [name, setName] = useState("")
+    const [password, setPassword] = useState("")
+    const focusTrapRef = useFocusTrap();
+    return (
+        <>
+            <Text mt="2em" ta="center">{message}</Text>
+            <Center>
+                <form ref={focusTrapRef} onSubmit={(e) => { e.preventDefault(); sendLogin(name, password)}}>
+                    <Stack mt="2em" w="20em">
+                        <TextInput data-autofocus label="User" value={name} onChange={(e) => setName(e.currentTarget.value)}/>
+                        <PasswordInput label="Password" value={password} onChange={(e) => setPassword(e.currentTarget.value)}/>
+                        <Button type="submit" disabled={!name || !password}>Log in</Button>
+                    </Stack>
+                </form>
+            </Center>
+        </>
+    )
+}
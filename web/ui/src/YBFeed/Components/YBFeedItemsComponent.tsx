@@ -8,13 +8,12 @@ export const FeedItemContext = createContext<undefined|YBFeedItem>(undefined);
 
 export interface YBFeedItemsComponentProps {
     feedName: string
-    secret: string
     onDelete?: (item: YBFeedItem) => void
     setEmpty?: (arg0: boolean) => void
 }
 
 export function YBFeedItemsComponent(props: YBFeedItemsComponentProps) {
-    const { feedName, secret } = props
+    const { feedName } = props
 
     const navigate = useNavigate()
     const [feedItems, setFeedItems] = useState<YBFeedItem[]>([])
@@ -39,7 +38,10 @@ export function YBFeedItemsComponent(props: YBFeedItemsComponentProps) {
     }
 
     useEffect(() => {
-        const webSocketURL = window.location.protocol.replace("http","ws") + "//" + window.location.host + "/ws/" + feedName + "?secret=" + secret
+        // The websocket is opened under the feed API path so that browsers
+        // send the secret cookie, logged in users are authenticated by their
+        // session cookie
+        const webSocketURL = window.location.protocol.replace("http","ws") + "//" + window.location.host + "/api/feeds/" + encodeURIComponent(feedName) + "/ws"
 
         function disconnect() {
             if (ws.current === null) {
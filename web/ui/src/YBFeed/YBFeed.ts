@@ -11,6 +11,7 @@ export class YBFeedError extends Error {
 export class YBFeed {
     name: string;
     secret: string|undefined;
+    scopes: string[]|undefined;
     items: YBFeedItem[];
     vapidpublickey: string|undefined;
     constructor(name: string) {
@@ -1,6 +1,7 @@
 import { AxiosResponseHeaders } from 'axios'
 import { YBFeed, YBFeedItem, YBFeedError } from '.'
 import { Y } from '../YBFeedClient'
+import { UserError } from '../APIClient'
 
 class YBFeedConnector {
     feedUrl(feedName: string): string {
@@ -43,7 +44,13 @@ class YBFeedConnector {
             // })
             .catch((e) => {
                 console.log(e)
-                reject(new YBFeedError(e.status, "Server Unavailable"))
+                if (e.response?.status === 401) {
+                    // Keep the server message, it tells a protected feed
+                    // from a feed that requires a login to be created
+                    reject(new YBFeedError(401, UserError(e)))
+                } else {
+                    reject(new YBFeedError(e.response?.status, "Server Unavailable"))
+                }
             })
 
             // fetch(this.feedUrl(feedName),{
@@ -70,14 +77,29 @@ class YBFeedConnector {
             // })
         })
     }
+    async Login(name: string, password: string): Promise<string> {
+        return new Promise((resolve, reject) => {
+            Y.post('/login', {name: name, password: password})
+            .then((u) => {
+                resolve((u as {user: string}).user)
+            })
+            .catch((error) => {
+                if (error.response?.status === 401) {
+                    reject(new YBFeedError(401, "Invalid user name or password"))
+                } else {
+                    reject(new YBFeedError(error.response?.status, "Server Unavailable"))
+                }
+            })
+        })
+    }
     async AuthenticateFeed(feedName: string, secret: string): Promise<string|YBFeedError> {
         return new Promise((resolve, reject) => {
             Y.get('/feeds/' + encodeURIComponent(feedName) + "?secret=" + encodeURIComponent(secret))
             .then((f) => {
                 const fe = f as YBFeed
-                if (fe.secret) {
-                    resolve(fe.secret)
-                }
+                // The feed secret is only returned to administrators, other
+                // clients are authenticated by the cookie set by the server
+                resolve(fe.secret ? fe.secret : "")
             })
             .catch((error) => {
                 if (error.status === 401) {
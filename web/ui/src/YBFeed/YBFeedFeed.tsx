@@ -15,9 +15,14 @@ import {
   } from '@tabler/icons-react';
 import { PinModal } from "./Components/PinModal";
 import { PinRequest } from "./Components/PinRequest";
+import { LoginRequest } from "./Components/LoginRequest";
 import { Connector } from "./YBFeedConnector";
 import { ConfirmPopoverButton } from "./Components/ConfirmPopoverButton";
 
+// Message returned by the server when an anonymous user opens a feed that
+// doesn't exist yet and anonymous feeds are disabled
+const feedCreationLoginMessage = "Authentication required to create a feed"
+
 export function YBFeedFeed() {
     const { feedName } = useParams()
     const navigate = useNavigate()
@@ -28,7 +33,12 @@ export function YBFeedFeed() {
 
     const [pinModalOpen,setPinModalOpen] = useState(false)
     const [authenticated,setAuthenticated] = useState<boolean|undefined>(undefined)
+    const [loginRequired,setLoginRequired] = useState<string|undefined>(undefined)
     const [vapid, setVapid] = useState<string|undefined>(undefined)
+    const [scopes, setScopes] = useState<string[]>([])
+
+    // The admin scope grants every other scope
+    const hasScope = (scope: string) => scopes.includes(scope) || scopes.includes("admin")
 
 
     const [fatal, setFatal] = useState(false)
@@ -53,33 +63,44 @@ export function YBFeedFeed() {
         }
     },[searchParams, feedName, secret])
 
-    // Get current feed over http without web-socket to fetch feed secret
-    // As websocket doesn't send current cookie, we have to perform a regular
-    // http request first to get the secret
-    useEffect(() => {
-        if (!secret && !searchParams.get("secret")) {
-            Connector.GetFeed(feedName)
-            .then((f) => {
-                if (f && f.secret) {
+    // Get current feed over http to check authentication and scopes. Only
+    // administrators get the feed secret, used to copy the feed link. The
+    // websocket is authenticated by the cookie set by the server.
+    const loadFeed = () => {
+        Connector.GetFeed(feedName)
+        .then((f) => {
+            if (f) {
+                if (f.secret) {
                     setSecret(f.secret)
-                    setVapid(f.vapidpublickey)
-                    setAuthenticated(true)
                 }
-            })
-            .catch((e) => {
-                console.log(e)
-                if (e.status === 401) {
-                    setAuthenticated(false)
-                }
-                else {
-                    setFatal(e.message)
-                }
-            })
+                setScopes(f.scopes ? f.scopes : [])
+                setVapid(f.vapidpublickey)
+                setLoginRequired(undefined)
+                setAuthenticated(true)
+            }
+        })
+        .catch((e) => {
+            console.log(e)
+            if (e.status === 401 && e.message === feedCreationLoginMessage) {
+                setLoginRequired(e.message)
+            }
+            else if (e.status === 401) {
+                setAuthenticated(false)
+            }
+            else {
+                setFatal(e.message)
+            }
+        })
+    }
+
+    useEffect(() => {
+        if (!secret && !searchParams.get("secret")) {
+            loadFeed()
         }
     },[secret,feedName,location])
 
     const copyLink = () => {
-        const link = window.location.href + "?secret=" + secret
+        const link = secret ? window.location.href + "?secret=" + secret : window.location.href
         navigator.clipboard.writeText(link)
         notifications.show({
             message:'Link Copied!', ...defaultNotificationProps
@@ -100,8 +121,18 @@ export function YBFeedFeed() {
 
     const sendPIN = (e: string) => {
         Connector.AuthenticateFeed(feedName,e)
-        .then((s) => {
-            setSecret(s.toString())
+        .then(() => {
+            loadFeed()
+        })
+        .catch((e) => {
+            notifications.show({message:e.message, color:"red", ...defaultNotificationProps})
+        })
+    }
+
+    const sendLogin = (name: string, password: string) => {
+        Connector.Login(name,password)
+        .then(() => {
+            loadFeed()
         })
         .catch((e) => {
             notifications.show({message:e.message, color:"red", ...defaultNotificationProps})
@@ -112,6 +143,12 @@ export function YBFeedFeed() {
         Connector.EmptyFeed(feedName)
     }
 
+    if (loginRequired)  {
+        return (
+            <LoginRequest message={loginRequired} sendLogin={sendLogin}/>
+        )
+    }
+
     if (authenticated===false)  {
         return (
             <PinRequest sendPIN={sendPIN}/>
@@ -129,7 +166,7 @@ export function YBFeedFeed() {
         {authenticated===true&&
         <>
             <Group gap="xs" justify="flex-end" style={{float: 'right'}}>
-                {!empty&&
+                {!empty&&hasScope("delete")&&
                 <ConfirmPopoverButton onConfirm={deleteAll} buttonTitle="Delete All" message="Do you really want to delete everything ?">
                     <Button size="xs" variant="outline" color="red">Empty</Button>
                 </ConfirmPopoverButton>
@@ -147,9 +184,11 @@ export function YBFeedFeed() {
                     <Menu.Item leftSection={<IconLink style={{ width: rem(14), height: rem(14) }} />} onClick={copyLink}>
                         Copy Permalink
                     </Menu.Item>
+                    {hasScope("admin")&&
                     <Menu.Item leftSection={<IconHash style={{ width: rem(14), height: rem(14) }} />} onClick={() => setPinModalOpen(true)}>
                         Set Temporary PIN
                     </Menu.Item>
+                    }
                     </Menu.Dropdown>
                 </Menu>
             </Group>
@@ -157,9 +196,13 @@ export function YBFeedFeed() {
             <YBBreadCrumbComponent />
             <PinModal opened={pinModalOpen} setOpened={() => setPinModalOpen(false)} setPIN={setPIN}/>
 
+            {hasScope("write")&&
             <YBPasteCardComponent/>
-            
-            <YBFeedItemsComponent feedName={feedName} secret={secret} setEmpty={setEmpty}/>
+            }
+
+            {hasScope("read")&&
+            <YBFeedItemsComponent feedName={feedName} setEmpty={setEmpty}/>
+            }
             </>
             }
        </Box>